@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robertantonyjaikumar/hangover-common/config"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"github.com/robertantonyjaikumar/hangover-common/middlewares"
+	"go.uber.org/zap"
+)
+
+// TokenHeader carries the admin token
+const TokenHeader = "X-Admin-Token"
+
+// RegisterRoutes mounts the admin endpoints under /admin when cfg enables
+// them. Callers need a valid client token and the admin token, any tenant
+// token alone is rejected.
+func RegisterRoutes(r gin.IRouter, cfg config.AdminConfig) {
+	if !cfg.Enabled {
+		return
+	}
+	group := r.Group("/admin", middlewares.AuthMiddleware(), RequireToken(cfg.Token))
+	group.GET("/config", ConfigHandler(config.Default()))
+	group.GET("/log/level", LogLevelHandler)
+	group.PUT("/log/level", SetLogLevelHandler)
+}
+
+// RequireToken aborts with 403 the requests whose TokenHeader is not token.
+// An empty token rejects every request.
+func RequireToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := c.GetHeader(TokenHeader)
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+// ConfigHandler serves the masked effective configuration with the source of each key
+func ConfigHandler(cfg *config.Configuration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"profile": cfg.Profile(),
+			"config":  cfg.Dump(),
+		})
+	}
+}
+
+type logLevel struct {
+	Level    string            `json:"level"`
+	Packages map[string]string `json:"packages"`
+}
+
+// LogLevelHandler serves the current log level and the level overrides of named loggers
+func LogLevelHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, logLevel{Level: logger.Level(), Packages: logger.PackageLevels()})
+}
+
+// SetLogLevelHandler changes the log level at runtime. Packages, when present,
+// replaces the level overrides. The change lasts until the log section of the
+// config is next reloaded.
+func SetLogLevelHandler(c *gin.Context) {
+	var body logLevel
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.Level != "" {
+		if err := logger.SetLevel(body.Level); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if body.Packages != nil {
+		if err := logger.SetPackageLevels(body.Packages); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	logger.Info("log level changed", zap.String("level", logger.Level()), zap.Any("packages", logger.PackageLevels()))
+	LogLevelHandler(c)
+}
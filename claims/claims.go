@@ -0,0 +1,75 @@
+// Package claims holds the JWT claims the auth middlewares put on a request
+// and reads them back from any context.
+package claims
+
+import "context"
+
+// Keys the claims are stored under in the gin context
+const (
+	// AuthKey holds the Auth claims of a client token, set by AuthMiddleware
+	AuthKey = "x-claim-payload"
+	// SessionKey holds the Session claims of a user session
+	SessionKey = "x-claim-payload-log"
+)
+
+// Auth are the claims of a client token
+type Auth struct {
+	TID  string `json:"tid"  binding:"required"`
+	Type string `json:"type" binding:"required"`
+	// CID identifies the client the token was issued to
+	CID string `json:"cid,omitempty"`
+}
+
+// Session are the claims of a user session token
+type Session struct {
+	TID  string `json:"tid"  binding:"required"`
+	Type string `json:"type" binding:"required"`
+	RID  string `json:"rid"  binding:"required"`
+	SID  string `json:"sid"  binding:"required"`
+	// Sub identifies the user, it outlives the session
+	Sub string `json:"sub,omitempty"`
+}
+
+// SessionFrom returns the Session claims stored under SessionKey. A
+// *gin.Context exposes its keys as values, so it can be passed directly.
+func SessionFrom(ctx context.Context) (Session, bool) {
+	if ctx == nil {
+		return Session{}, false
+	}
+	switch session := ctx.Value(SessionKey).(type) {
+	case Session:
+		return session, true
+	case *Session:
+		if session != nil {
+			return *session, true
+		}
+	}
+	return Session{}, false
+}
+
+// AuthFrom returns the Auth claims stored under AuthKey
+func AuthFrom(ctx context.Context) (Auth, bool) {
+	if ctx == nil {
+		return Auth{}, false
+	}
+	switch auth := ctx.Value(AuthKey).(type) {
+	case Auth:
+		return auth, true
+	case *Auth:
+		if auth != nil {
+			return *auth, true
+		}
+	}
+	return Auth{}, false
+}
+
+// TenantFrom returns the tenant of the session claims, else of the auth claims
+func TenantFrom(ctx context.Context) string {
+	if session, ok := SessionFrom(ctx); ok {
+		return session.TID
+	}
+	if auth, ok := AuthFrom(ctx); ok {
+		return auth.TID
+	}
+	return ""
+}
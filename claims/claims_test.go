@@ -0,0 +1,68 @@
+package claims
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFrom(t *testing.T) {
+	session := Session{TID: "acme", Type: "user", RID: "admin", SID: "s1", Sub: "u1"}
+	auth := Auth{TID: "globex", Type: "service", CID: "c1"}
+	tests := []struct {
+		name       string
+		values     map[string]interface{}
+		session    Session
+		hasSession bool
+		auth       Auth
+		hasAuth    bool
+		tenant     string
+	}{
+		{name: "none"},
+		{name: "session", values: map[string]interface{}{SessionKey: session}, session: session, hasSession: true, tenant: "acme"},
+		{name: "session pointer", values: map[string]interface{}{SessionKey: &session}, session: session, hasSession: true, tenant: "acme"},
+		{name: "nil session pointer", values: map[string]interface{}{SessionKey: (*Session)(nil)}},
+		{name: "auth", values: map[string]interface{}{AuthKey: auth}, auth: auth, hasAuth: true, tenant: "globex"},
+		{name: "auth pointer", values: map[string]interface{}{AuthKey: &auth}, auth: auth, hasAuth: true, tenant: "globex"},
+		{name: "session tenant first", values: map[string]interface{}{SessionKey: session, AuthKey: auth}, session: session, hasSession: true, auth: auth, hasAuth: true, tenant: "acme"},
+		{name: "other types", values: map[string]interface{}{SessionKey: "acme", AuthKey: map[string]string{"tid": "acme"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			for key, value := range tt.values {
+				ctx = context.WithValue(ctx, key, value)
+				c.Set(key, value)
+			}
+			for name, ctx := range map[string]context.Context{"context": ctx, "gin": c} {
+				session, ok := SessionFrom(ctx)
+				if ok != tt.hasSession || session != tt.session {
+					t.Errorf("%s: SessionFrom = %+v, %v, want %+v, %v", name, session, ok, tt.session, tt.hasSession)
+				}
+				auth, ok := AuthFrom(ctx)
+				if ok != tt.hasAuth || auth != tt.auth {
+					t.Errorf("%s: AuthFrom = %+v, %v, want %+v, %v", name, auth, ok, tt.auth, tt.hasAuth)
+				}
+				if tenant := TenantFrom(ctx); tenant != tt.tenant {
+					t.Errorf("%s: TenantFrom = %q, want %q", name, tenant, tt.tenant)
+				}
+			}
+		})
+	}
+}
+
+func TestFromNilContext(t *testing.T) {
+	var ctx context.Context
+	if _, ok := SessionFrom(ctx); ok {
+		t.Error("SessionFrom(nil) found claims")
+	}
+	if _, ok := AuthFrom(ctx); ok {
+		t.Error("AuthFrom(nil) found claims")
+	}
+	if tenant := TenantFrom(ctx); tenant != "" {
+		t.Errorf("TenantFrom(nil) = %q", tenant)
+	}
+}
@@ -0,0 +1,140 @@
+// Command hangover inspects and checks the configuration of a service using
+// hangover-common. Run it from the directory holding config.yaml:
+//
+//	hangover config dump
+//	hangover config schema
+//	hangover config validate config.yaml
+//	hangover config validate --runtime config.yaml
+//	hangover config encrypt config.yaml database.password
+//
+// encrypt, decrypt and rotate read the key from CONFIG_ENCRYPTION_KEY or
+// CONFIG_ENCRYPTION_KEY_FILE. To rotate, generate a key with keygen, set it as
+// CONFIG_ENCRYPTION_KEY, move the previous one to CONFIG_ENCRYPTION_OLD_KEYS
+// and run rotate on every file.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/robertantonyjaikumar/hangover-common/config"
+)
+
+const usage = `usage: hangover config <command>
+
+commands:
+  dump             print the effective configuration with the source of each key, secrets masked
+  schema           print the JSON Schema of the typed configuration
+  validate [--runtime] <file>
+                   check a config file, with env overrides, against the schema and validators;
+                   --runtime also checks the environment, such as secrets and TLS files
+  keygen           print a new encryption key
+  encrypt <file> <key>...
+                   encrypt the values of keys in the file in place
+  decrypt <file>   decrypt every ENC[...] value of the file in place
+  rotate <file>    re-encrypt every ENC[...] value of the file with the current key
+`
+
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "config" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	switch os.Args[2] {
+	case "dump":
+		os.Exit(printJSON(config.Default().Dump()))
+	case "schema":
+		os.Exit(printJSON(config.Schema()))
+	case "validate":
+		args := os.Args[3:]
+		runtime := len(args) > 0 && args[0] == "--runtime"
+		if runtime {
+			args = args[1:]
+		}
+		if len(args) != 1 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		os.Exit(validate(args[0], runtime))
+	case "keygen":
+		key, err := config.GenerateKey()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(key)
+	case "encrypt", "decrypt", "rotate":
+		if len(os.Args) < 4 || (os.Args[2] == "encrypt") != (len(os.Args) > 4) {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		os.Exit(crypt(os.Args[2], os.Args[3], os.Args[4:]))
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func printJSON(v interface{}) int {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(out))
+	return 0
+}
+
+// validate checks file read by the config loader, so env overrides, secret
+// references and encrypted values apply as they do in a service
+func validate(file string, runtime bool) int {
+	if _, err := os.Stat(file); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+		return 1
+	}
+	c, err := config.New(config.Options{File: file})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+		return 1
+	}
+
+	validate := config.Validate
+	if runtime {
+		validate = config.ValidateRuntime
+	}
+	err = validate(c.Viper())
+	var verr *config.ValidationError
+	if errors.As(err, &verr) {
+		for _, fieldErr := range verr.Errors {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, fieldErr.Error())
+		}
+		return 1
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+		return 1
+	}
+	fmt.Printf("%s: ok\n", file)
+	return 0
+}
+
+func crypt(command, file string, keys []string) int {
+	ring, err := config.LoadKeyRing()
+	if err == nil {
+		switch command {
+		case "encrypt":
+			err = config.EncryptFile(file, ring, keys)
+		case "decrypt":
+			err = config.DecryptFile(file, ring)
+		case "rotate":
+			err = config.RotateFile(file, ring)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+		return 1
+	}
+	fmt.Printf("%s: ok\n", file)
+	return 0
+}
@@ -0,0 +1,21 @@
+package config
+
+// AdminConfig configures the admin endpoints. They are off unless enabled and
+// need the admin token on top of a valid client token.
+type AdminConfig struct {
+	Enabled bool   `config:"enabled" desc:"serve the admin endpoints"`
+	Token   string `config:"token" desc:"secret callers send in the X-Admin-Token header, required when enabled"`
+}
+
+// Check requires a token of at least 32 characters when enabled
+func (c *AdminConfig) Check() []FieldError {
+	if c.Enabled && len(c.Token) < 32 {
+		return []FieldError{{Key: "token", Message: "must be at least 32 characters when enabled"}}
+	}
+	return nil
+}
+
+// LoadAdminConfig returns admin config, with every invalid key in the error
+func LoadAdminConfig() (AdminConfig, error) {
+	return Load[AdminConfig](LoadOptions{Prefix: "admin"})
+}
@@ -1,13 +1,39 @@
 package config
 
+import (
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"go.uber.org/zap"
+)
+
 type AuthConfig struct {
-	AccessSecret  string
-	RefreshSecret string
+	AccessSecret  string `config:"ACCESS_SECRET" desc:"HMAC secret of access tokens, required at runtime"`
+	RefreshSecret string `config:"REFRESH_SECRET" desc:"HMAC secret of refresh tokens, required at runtime"`
+}
+
+// CheckRuntime requires both secrets, usually supplied by the environment
+func (c *AuthConfig) CheckRuntime() []FieldError {
+	var errs []FieldError
+	if c.AccessSecret == "" {
+		errs = append(errs, FieldError{Key: "ACCESS_SECRET", Message: "is required"})
+	}
+	if c.RefreshSecret == "" {
+		errs = append(errs, FieldError{Key: "REFRESH_SECRET", Message: "is required"})
+	}
+	return errs
+}
+
+// LoadAuthConfigE returns the token secrets, with an error listing any that
+// are missing. Abort startup on error, tokens cannot be verified without them.
+func LoadAuthConfigE() (AuthConfig, error) {
+	return Load[AuthConfig](LoadOptions{})
 }
 
+// Deprecated: use LoadAuthConfigE, LoadAuthConfig logs the missing secrets
+// and returns the others
 func LoadAuthConfig() AuthConfig {
-	return AuthConfig{
-		AccessSecret:  CFG.V.Get("ACCESS_SECRET").(string),
-		RefreshSecret: CFG.V.Get("REFRESH_SECRET").(string),
+	cfg, err := LoadAuthConfigE()
+	if err != nil {
+		logger.Error("invalid auth config", zap.Error(err))
 	}
+	return cfg
 }
@@ -1,57 +1,342 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
 	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
-	"os"
 )
 
 const (
 	varLogLevel     = "log.level"
 	varPathToConfig = "../config.yaml"
+	envProfile      = "APP_ENV"
+
+	SourceDefault = "default"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
 )
 
 var (
-	CFG = GetConfig()
+	// CFG is the default configuration read by the package level loaders. It
+	// is read from the working directory on first use of Default, call Init
+	// or SetDefault before to control how.
+	CFG = &Configuration{V: viper.GetViper()}
+
+	defaultOnce sync.Once
 )
 
 type Configuration struct {
+	// V is the viper the configuration was first read into, or Options.Viper
+	// holding a copy of its settings. Reload swaps in a new one, read the
+	// current config with Viper.
 	V *viper.Viper
+
+	dir     string
+	profile string
+	// file replaces the config file layers when set, see Options.File
+	file  string
+	flags *pflag.FlagSet
+	// defaults are the settings of Options.Viper, applied as defaults
+	defaults map[string]interface{}
+	watch    watchState
+	current  atomic.Pointer[snapshot]
+}
+
+// snapshot is the config applied by New or the last Reload
+type snapshot struct {
+	v *viper.Viper
+	// files maps every key read from a config file to the last file setting it
+	files map[string]string
+	// secretKeys are the keys whose value was resolved from a secret reference
+	// or decrypted
+	secretKeys map[string]bool
+}
+
+// layers is the config read from the files and the environment
+type layers struct {
+	settings   *viper.Viper
+	files      map[string]string
+	secretKeys map[string]bool
+	// env holds the keys whose env var is a secret reference, with the
+	// resolved value
+	env map[string]string
+}
+
+// envName returns the env var overriding key: SERVER_PORT for server.port
+func envName(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// envKeyReplacer maps the keys viper looks up in the environment to env var
+// names. The env vars holding secret references are hidden, their resolved
+// values are merged above the config files instead.
+type envKeyReplacer struct {
+	hidden map[string]bool
+}
+
+func (r envKeyReplacer) Replace(key string) string {
+	name := envName(key)
+	if r.hidden[name] {
+		return ""
+	}
+	return name
+}
+
+// Options configures New
+type Options struct {
+	// Dir holds the config files, defaults to the working directory
+	Dir string
+	// Profile selects config.<profile>.yaml, defaults to APP_ENV
+	Profile string
+	// File is a YAML file read instead of the config file layers, Dir and
+	// Profile are ignored. The env and flag layers still apply.
+	File string
+	// Viper receives a copy of the settings read, its own settings are used
+	// as defaults. The configuration itself is held by a viper of New, see
+	// Configuration.Viper.
+	Viper *viper.Viper
+	// Flags are bound as the highest precedence layer, see BindFlags
+	Flags *pflag.FlagSet
+}
+
+// New reads the configuration described by opts. Layers are applied in
+// increasing precedence:
+//
+//	defaults < config.yaml < config.<profile>.yaml < config.local.yaml < env < flags
+//
+// The env var of a key is its uppercased path with dots replaced by
+// underscores: SERVER_PORT sets server.port. Errors reading any layer are
+// returned along with the configuration built from the others.
+func New(opts Options) (*Configuration, error) {
+	if opts.Dir == "" {
+		opts.Dir = "./"
+	}
+	if opts.Profile == "" {
+		opts.Profile = os.Getenv(envProfile)
+	}
+	c := &Configuration{
+		dir:     opts.Dir,
+		profile: strings.ToLower(opts.Profile),
+		flags:   opts.Flags,
+	}
+	if opts.File != "" {
+		base := filepath.Base(opts.File)
+		c.dir, c.profile = filepath.Dir(opts.File), ""
+		c.file = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if opts.Viper != nil {
+		c.defaults = map[string]interface{}{}
+		for _, key := range opts.Viper.AllKeys() {
+			c.defaults[key] = opts.Viper.Get(key)
+		}
+	}
+
+	logger.Info("loading config", zap.String("dir", c.dir), zap.String("profile", c.profile))
+	read, err := c.readLayers()
+	v, buildErr := c.build(read)
+	err = errors.Join(err, buildErr)
+	c.V = v
+	if opts.Viper != nil {
+		err = errors.Join(err, opts.Viper.MergeConfigMap(v.AllSettings()))
+		c.V = opts.Viper
+	}
+	c.current.Store(&snapshot{v: v, files: read.files, secretKeys: read.secretKeys})
+	return c, err
+}
+
+// build returns a new viper with the defaults, read, the env vars and the
+// flags, in increasing precedence
+func (c *Configuration) build(read layers) (*viper.Viper, error) {
+	hidden := make(map[string]bool, len(read.env))
+	for key := range read.env {
+		hidden[envName(key)] = true
+	}
+	v := viper.NewWithOptions(viper.EnvKeyReplacer(envKeyReplacer{hidden: hidden}))
+	v.SetConfigType("yaml")
+	v.SetDefault(varLogLevel, "info")
+	for key, value := range c.defaults {
+		v.SetDefault(key, value)
+	}
+	v.AutomaticEnv()
+	if err := v.MergeConfigMap(read.settings.AllSettings()); err != nil {
+		return v, err
+	}
+	// the env layer of the secret references, merged above the files
+	if len(read.env) > 0 {
+		env := viper.New()
+		for key, value := range read.env {
+			env.Set(key, value)
+		}
+		if err := v.MergeConfigMap(env.AllSettings()); err != nil {
+			return v, err
+		}
+	}
+	if c.flags != nil {
+		return v, v.BindPFlags(c.flags)
+	}
+	return v, nil
+}
+
+// Viper returns the viper holding the current config
+func (c *Configuration) Viper() *viper.Viper {
+	return c.snapshot().v
+}
+
+func (c *Configuration) snapshot() *snapshot {
+	if s := c.current.Load(); s != nil {
+		return s
+	}
+	return &snapshot{v: c.V}
 }
 
 // GetConfig return a Configuration struct with allows to
-// get viper configurations from yaml and env variables
+// get viper configurations from yaml and env variables.
+// It reads the working directory into the global viper and logs errors.
 func GetConfig() *Configuration {
-	c := Configuration{
-		V: viper.GetViper(),
-	}
-	c.V.SetDefault(varLogLevel, "info")
-	c.V.AutomaticEnv()
-	c.V.SetConfigType("yaml")
-	c.V.SetConfigName("config")
-	c.V.AddConfigPath("./")
-	err := c.V.ReadInConfig() // Find and read the config file
-
-	logger.Info("loading config")
-	if _, ok := err.(*os.PathError); ok {
-		logger.Error(
-			"no config file not found. Using default values",
-			zap.String("config_path", c.GetPathToConfig()),
-		)
-	} else if err != nil { // Handle other errors that occurred while reading the config file
+	c, err := New(Options{Viper: viper.GetViper()})
+	if err != nil { // Handle errors that occurred while reading the config files
 		logger.Error("fatal error while reading the config file", zap.Error(err))
 	}
-	return &c
+	return c
+}
+
+// Init reads the configuration described by opts and makes it the default
+func Init(opts Options) (*Configuration, error) {
+	c, err := New(opts)
+	SetDefault(c)
+	return c, err
+}
+
+// SetDefault makes c the configuration returned by Default and held by CFG
+func SetDefault(c *Configuration) {
+	defaultOnce.Do(func() {})
+	CFG = c
+}
+
+// Default returns CFG, reading it with GetConfig on first use unless Init or
+// SetDefault was called before
+func Default() *Configuration {
+	defaultOnce.Do(func() {
+		CFG = GetConfig()
+	})
+	return CFG
+}
+
+// layerNames returns the config file names in increasing precedence
+func (c *Configuration) layerNames() []string {
+	if c.file != "" {
+		return []string{c.file}
+	}
+	names := []string{"config"}
+	if c.profile != "" {
+		names = append(names, "config."+c.profile)
+	}
+	return append(names, "config.local")
+}
+
+// readLayers merges every config file layer into a new viper and returns it
+// with the file supplying each key. Files that fail to parse are skipped and
+// reported in the error. Secret references are resolved, see Secrets.
+func (c *Configuration) readLayers() (layers, error) {
+	merged := viper.New()
+	files := map[string]string{}
+	var errs []error
+	for i, name := range c.layerNames() {
+		layer := viper.New()
+		layer.SetConfigType("yaml")
+		layer.SetConfigName(name)
+		layer.AddConfigPath(c.dir)
+		err := layer.ReadInConfig() // Find and read the config file
+
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(err, &notFound) {
+			// only the base file is expected to exist
+			if i == 0 {
+				logger.Error(
+					"no config file not found. Using default values",
+					zap.String("config_path", c.GetPathToConfig()),
+				)
+			}
+			continue
+		} else if err == nil {
+			err = merged.MergeConfigMap(layer.AllSettings())
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		file := filepath.Base(layer.ConfigFileUsed())
+		for _, key := range layer.AllKeys() {
+			files[key] = file
+		}
+	}
+	read := layers{settings: merged, files: files, secretKeys: map[string]bool{}, env: map[string]string{}}
+	if err := decryptValues(merged, read.secretKeys); err != nil {
+		errs = append(errs, fmt.Errorf("could not decrypt config: %w", err))
+	}
+	if err := resolveSecrets(read); err != nil {
+		errs = append(errs, err)
+	}
+	return read, errors.Join(errs...)
+}
+
+// BindFlags makes flags the highest precedence layer. Flag names are config keys.
+func (c *Configuration) BindFlags(flags *pflag.FlagSet) error {
+	c.flags = flags
+	return c.Viper().BindPFlags(flags)
+}
 
+// Profile returns the profile selected by APP_ENV, empty when unset
+func (c *Configuration) Profile() string {
+	return c.profile
+}
+
+// Source returns the layer supplying key: a config file name, SourceEnv,
+// SourceFlag or SourceDefault. It is empty when the key is not set.
+func (c *Configuration) Source(key string) string {
+	key = strings.ToLower(key)
+	if c.flags != nil {
+		if flag := c.flags.Lookup(key); flag != nil && flag.Changed {
+			return SourceFlag
+		}
+	}
+	if _, ok := os.LookupEnv(envName(key)); ok {
+		return SourceEnv
+	}
+	current := c.snapshot()
+	if file, ok := current.files[key]; ok {
+		return file
+	}
+	if current.v.IsSet(key) {
+		return SourceDefault
+	}
+	return ""
+}
+
+// Sources returns the layer supplying every known key
+func (c *Configuration) Sources() map[string]string {
+	sources := map[string]string{}
+	for _, key := range c.Viper().AllKeys() {
+		sources[key] = c.Source(key)
+	}
+	return sources
 }
 
 // GetServiceName returns service name
 func (c *Configuration) GetServiceName() string {
-	return c.V.GetString("service.name")
+	return c.Viper().GetString("service.name")
 
 }
 
 func (c *Configuration) GetPathToConfig() string {
-	return c.V.GetString(varPathToConfig)
+	return c.Viper().GetString(varPathToConfig)
 }
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestNewPrecedence(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `
+server:
+  port: "1000"
+  base_path: /base
+  read_timeout: 1s
+service:
+  name: base
+log:
+  level: warn
+feature:
+  token: plain
+`,
+		"config.dev.yaml":   "server:\n  port: \"2000\"\nservice:\n  name: dev\n",
+		"config.local.yaml": "server:\n  base_path: /local\n",
+	})
+	t.Setenv("SERVER_PORT", "3000")
+	t.Setenv("FEATURE_TOKEN", "secret://env#TOKEN_VALUE")
+	t.Setenv("TOKEN_VALUE", "from-secret")
+	t.Setenv("SERVER_READ_TIMEOUT", "secret://env#TIMEOUT_VALUE")
+	t.Setenv("TIMEOUT_VALUE", "3s")
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("server.read_timeout", "1s", "")
+	if err := flags.Parse([]string{"--server.read_timeout=5s"}); err != nil {
+		t.Fatal(err)
+	}
+	base := viper.New()
+	base.SetDefault("extra.option", "dflt")
+
+	c, err := New(Options{Dir: dir, Profile: "dev", Flags: flags, Viper: base})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key    string
+		want   string
+		source string
+	}{
+		{"extra.option", "dflt", SourceDefault},
+		{"log.level", "warn", "config.yaml"},
+		{"service.name", "dev", "config.dev.yaml"},
+		{"server.base_path", "/local", "config.local.yaml"},
+		{"server.port", "3000", SourceEnv},
+		{"feature.token", "from-secret", SourceEnv},
+		{"server.read_timeout", "5s", SourceFlag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := c.Viper().GetString(tt.key); got != tt.want {
+				t.Errorf("value = %q, want %q", got, tt.want)
+			}
+			if got := c.Source(tt.key); got != tt.source {
+				t.Errorf("Source = %q, want %q", got, tt.source)
+			}
+		})
+	}
+	if !c.IsSecret("feature.token") {
+		t.Error("feature.token not reported as a secret")
+	}
+	if got := base.GetString("server.port"); got != "3000" {
+		t.Errorf("Options.Viper server.port = %q, want the settings read", got)
+	}
+}
+
+func TestNewSkipsUnrelatedSecretEnv(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{"config.yaml": "feature:\n  token: plain\n"})
+	t.Setenv("FEATURE_TOKEN", "secret://env#TOKEN_VALUE")
+	t.Setenv("TOKEN_VALUE", "from-secret")
+	t.Setenv("DB_PASSWORD", "secret://env#DB_PASSWORD_VALUE")
+	t.Setenv("DB_PASSWORD_VALUE", "db-secret")
+	// owned by another program, its provider is not registered here
+	t.Setenv("SIDECAR_TOKEN", "secret://sidecar/token#value")
+	// the env provider caches the environment it read first
+	Secrets.Invalidate()
+
+	c, err := New(Options{Dir: dir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for key, want := range map[string]string{"feature.token": "from-secret", "DB_PASSWORD": "db-secret"} {
+		if got := c.Viper().GetString(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if got := c.Viper().GetString("sidecar_token"); got != "secret://sidecar/token#value" {
+		t.Errorf("sidecar_token = %q, want the unresolved reference", got)
+	}
+}
+
+func TestNewFile(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml":     "service:\n  name: base\n",
+		"staging.yaml":    "server:\n  port: \"1000\"\n",
+		"config.dev.yaml": "service:\n  name: dev\n",
+	})
+	t.Setenv("SERVER_PORT", "3000")
+
+	c, err := New(Options{File: filepath.Join(dir, "staging.yaml"), Profile: "dev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Viper().GetString("server.port"); got != "3000" {
+		t.Errorf("server.port = %q, want the env override", got)
+	}
+	if got := c.Viper().GetString("service.name"); got != "" {
+		t.Errorf("service.name = %q, want the layers not read", got)
+	}
+}
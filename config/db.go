@@ -1,7 +1,12 @@
 package config
 
 import (
+	"path/filepath"
+	"strings"
+	"sync"
+
 	"github.com/fsnotify/fsnotify"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
@@ -12,6 +17,9 @@ type DBConfig struct {
 	Creds  *DBCreds
 	DBName string
 	Port   string
+	// RequestIDComments tags every statement with the request ID, see
+	// database.RequestIDPlugin. Read from request_id_comments.
+	RequestIDComments bool
 }
 
 type host struct {
@@ -25,26 +33,26 @@ type DBCreds struct {
 	Password string
 }
 
-var DbViper *viper.Viper
+var (
+	DbViper *viper.Viper
+
+	credsWatcher struct {
+		sync.Mutex
+		watcher *fsnotify.Watcher
+	}
+)
 
 func loadDbCreds() *DBCreds {
 	logger, _ := zap.NewProduction()
 	defer logger.Sync() // flushes buffer, if any
 	sugar := logger.Sugar()
 
-	DbViper = viper.New()
-
-	DbViper.SetConfigType("env")
-	DbViper.SetConfigName("db")
-	DbViper.AddConfigPath("/vault/secrets/")
-	DbViper.AddConfigPath("./")
-
+	DbViper = newCredsViper("db")
 	err := DbViper.ReadInConfig()
 	if err != nil {
 		sugar.Errorw("Error occurred ", "err", err)
 	}
-	DbViper.WatchConfig()
-	DbViper.OnConfigChange(func(in fsnotify.Event) {
+	watchCreds(DbViper, func(in fsnotify.Event) {
 		logger.Info("database config changed", zap.String("name", in.Name), zap.Any("op", in.Op))
 	})
 	return &DBCreds{
@@ -54,55 +62,223 @@ func loadDbCreds() *DBCreds {
 
 }
 
+// watchCreds re-reads v when its file changes, replacing viper's WatchConfig
+// which cannot be stopped
+func watchCreds(v *viper.Viper, onChange func(in fsnotify.Event)) {
+	file := v.ConfigFileUsed()
+	if file == "" {
+		return
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Error("could not watch database config", zap.Error(err))
+		return
+	}
+	// watch the directory so atomic replaces by the vault agent are seen
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		logger.Error("could not watch database config", zap.String("file", file), zap.Error(err))
+		watcher.Close()
+		return
+	}
+	StopWatching()
+	credsWatcher.Lock()
+	credsWatcher.watcher = watcher
+	credsWatcher.Unlock()
+
+	go func() {
+		realFile, _ := filepath.EvalSymlinks(file)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				currentFile, _ := filepath.EvalSymlinks(file)
+				written := filepath.Clean(event.Name) == filepath.Clean(file) && event.Op&(fsnotify.Write|fsnotify.Create) != 0
+				if !written && currentFile == realFile {
+					continue
+				}
+				realFile = currentFile
+				if err := v.ReadInConfig(); err != nil {
+					logger.Error("could not reload database config", zap.Error(err))
+				}
+				onChange(event)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Error("database config watcher failed", zap.Error(err))
+			}
+		}
+	}()
+}
+
+// StopWatching stops watching the database credentials file
+func StopWatching() {
+	credsWatcher.Lock()
+	defer credsWatcher.Unlock()
+	if credsWatcher.watcher != nil {
+		credsWatcher.watcher.Close()
+		credsWatcher.watcher = nil
+	}
+}
+
+// newCredsViper returns a viper reading <name>.env from the vault secrets mount or ./
+func newCredsViper(name string) *viper.Viper {
+	v := viper.New()
+	v.SetConfigType("env")
+	v.SetConfigName(name)
+	v.AddConfigPath("/vault/secrets/")
+	v.AddConfigPath("./")
+	return v
+}
+
 // LoadDatabaseConfig returns db configs
 func LoadDatabaseConfig() *DBConfig {
+	cfg := Default()
 	dbcreds := loadDbCreds()
 	var dbconfig *DBConfig
 
-	if CFG.V.GetString("env") == "hosted" {
+	if cfg.Viper().GetString("env") == "hosted" {
 		dbconfig = &DBConfig{
-			Driver: CFG.V.GetString("database.driver"),
+			Driver: cfg.Viper().GetString("database.driver"),
 			Hosts: host{
-				Master:   CFG.V.GetString("database.hosts.master"),
-				Sources:  CFG.V.GetStringSlice("database.hosts.sources"),
-				Replicas: CFG.V.GetStringSlice("database.hosts.replicas"),
+				Master:   cfg.Viper().GetString("database.hosts.master"),
+				Sources:  cfg.Viper().GetStringSlice("database.hosts.sources"),
+				Replicas: cfg.Viper().GetStringSlice("database.hosts.replicas"),
 			},
 			Creds:  dbcreds,
-			DBName: CFG.V.GetString("database.dbname"),
-			Port:   CFG.V.GetString("database.port"),
+			DBName: cfg.Viper().GetString("database.dbname"),
+			Port:   cfg.Viper().GetString("database.port"),
+
+			RequestIDComments: cfg.Viper().GetBool("database.request_id_comments"),
 		}
 
 	} else {
 		dbconfig = &DBConfig{
-			Driver: CFG.V.GetString("database.driver"),
+			Driver: cfg.Viper().GetString("database.driver"),
 			Hosts: host{
-				Master: CFG.V.GetString("database.host"),
+				Master: cfg.Viper().GetString("database.host"),
 			},
 			Creds:  dbcreds,
-			DBName: CFG.V.GetString("database.dbname"),
-			Port:   CFG.V.GetString("database.port"),
+			DBName: cfg.Viper().GetString("database.dbname"),
+			Port:   cfg.Viper().GetString("database.port"),
+
+			RequestIDComments: cfg.Viper().GetBool("database.request_id_comments"),
 		}
 	}
 	return dbconfig
 
 }
 
+// databaseEnvKeys are the env vars read by LoadDatabaseVaultConfig, they have
+// no config file key
+var databaseEnvKeys = []string{
+	"DATABASE_DRIVER", "DATABASE_SOURCE", "DATABASE_REPLICA",
+	"DB_USERNAME", "DB_PASSWORD", "DB_NAME", "DB_PORT",
+}
+
+// databaseEnvNames returns the env vars read for the database config: those of
+// LoadDatabaseVaultConfig and the credentials of the databases with creds.source env
+func databaseEnvNames(v *viper.Viper) []string {
+	names := append([]string(nil), databaseEnvKeys...)
+	for name := range v.GetStringMap("databases") {
+		if v.GetString("databases."+name+".creds.source") == "env" {
+			envPrefix := strings.ToUpper(name) + "_DB_"
+			names = append(names, envPrefix+"USERNAME", envPrefix+"PASSWORD")
+		}
+	}
+	return names
+}
+
 // LoadDatabaseVaultConfig loads database config and secrets from a single vault kv store
 func LoadDatabaseVaultConfig() *DBConfig {
+	cfg := Default()
 	dbconfig := &DBConfig{
-		Driver: CFG.V.GetString("DATABASE_DRIVER"),
+		Driver: cfg.Viper().GetString("DATABASE_DRIVER"),
 		Hosts: host{
-			Master:   CFG.V.GetString("DATABASE_SOURCE"),
-			Sources:  []string{CFG.V.GetString("DATABASE_SOURCE")},
-			Replicas: []string{CFG.V.GetString("DATABASE_REPLICA")},
+			Master:   cfg.Viper().GetString("DATABASE_SOURCE"),
+			Sources:  []string{cfg.Viper().GetString("DATABASE_SOURCE")},
+			Replicas: []string{cfg.Viper().GetString("DATABASE_REPLICA")},
 		},
 		Creds: &DBCreds{
-			Username: CFG.V.GetString("DB_USERNAME"),
-			Password: CFG.V.GetString("DB_PASSWORD"),
+			Username: cfg.Viper().GetString("DB_USERNAME"),
+			Password: cfg.Viper().GetString("DB_PASSWORD"),
 		},
-		DBName: CFG.V.GetString("DB_NAME"),
-		Port:   CFG.V.GetString("DB_PORT"),
+		DBName: cfg.Viper().GetString("DB_NAME"),
+		Port:   cfg.Viper().GetString("DB_PORT"),
+
+		RequestIDComments: cfg.Viper().GetBool("database.request_id_comments"),
 	}
 
 	return dbconfig
 }
+
+// DatabaseNames returns the names of the databases configured under databases.<name>
+func DatabaseNames() []string {
+	cfg := Default()
+	var names []string
+	for name := range cfg.Viper().GetStringMap("databases") {
+		names = append(names, name)
+	}
+	return names
+}
+
+// DatabaseConfigured reports whether databases.<name> is configured
+func DatabaseConfigured(name string) bool {
+	return Default().Viper().IsSet("databases." + name)
+}
+
+// LoadNamedDatabaseConfig returns the config of databases.<name>. Credentials
+// come from databases.<name>.creds.source:
+//   - vault (default): db_username and db_password of /vault/secrets/<creds.file>.env, creds.file defaults to name
+//   - env: <NAME>_DB_USERNAME and <NAME>_DB_PASSWORD
+//   - config: databases.<name>.creds.username and databases.<name>.creds.password
+func LoadNamedDatabaseConfig(name string) *DBConfig {
+	cfg := Default()
+	prefix := "databases." + name + "."
+	return &DBConfig{
+		Driver: cfg.Viper().GetString(prefix + "driver"),
+		Hosts: host{
+			Master:   cfg.Viper().GetString(prefix + "hosts.master"),
+			Sources:  cfg.Viper().GetStringSlice(prefix + "hosts.sources"),
+			Replicas: cfg.Viper().GetStringSlice(prefix + "hosts.replicas"),
+		},
+		Creds:  loadNamedDbCreds(name),
+		DBName: cfg.Viper().GetString(prefix + "dbname"),
+		Port:   cfg.Viper().GetString(prefix + "port"),
+
+		RequestIDComments: cfg.Viper().GetBool(prefix + "request_id_comments"),
+	}
+}
+
+func loadNamedDbCreds(name string) *DBCreds {
+	cfg := Default()
+	prefix := "databases." + name + ".creds."
+	switch cfg.Viper().GetString(prefix + "source") {
+	case "env":
+		envPrefix := strings.ToUpper(name) + "_DB_"
+		return &DBCreds{
+			Username: cfg.Viper().GetString(envPrefix + "USERNAME"),
+			Password: cfg.Viper().GetString(envPrefix + "PASSWORD"),
+		}
+	case "config":
+		return &DBCreds{
+			Username: cfg.Viper().GetString(prefix + "username"),
+			Password: cfg.Viper().GetString(prefix + "password"),
+		}
+	default:
+		file := cfg.Viper().GetString(prefix + "file")
+		if file == "" {
+			file = name
+		}
+		v := newCredsViper(file)
+		if err := v.ReadInConfig(); err != nil {
+			logger.Error("could not read database credentials", zap.String("database", name), zap.Error(err))
+		}
+		return &DBCreds{
+			Username: v.GetString("db_username"),
+			Password: v.GetString("db_password"),
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"path"
+	"strings"
+)
+
+const maskedValue = "******"
+
+// SecretPatterns are glob patterns of keys whose values Dump masks. They match
+// the whole lowercased key or its last segment. Patterns listed under
+// config.mask_patterns are added to them.
+var SecretPatterns = []string{"*secret*", "*password*", "*passwd*", "*token*", "*credential*", "*private_key*", "*api_key*"}
+
+// DumpValue is a resolved config value and the layer supplying it
+type DumpValue struct {
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+	Masked bool        `json:"masked,omitempty"`
+}
+
+// Dump returns the effective configuration as a tree of DumpValue leaves.
+// Values of secret looking keys and of resolved secret references are masked.
+func (c *Configuration) Dump() map[string]interface{} {
+	patterns := append(append([]string(nil), SecretPatterns...), c.Viper().GetStringSlice("config.mask_patterns")...)
+	tree := map[string]interface{}{}
+	for _, key := range c.Viper().AllKeys() {
+		leaf := DumpValue{Value: c.Viper().Get(key), Source: c.Source(key)}
+		if c.IsSecret(key) || matchesAny(key, patterns) {
+			leaf.Value = maskedValue
+			leaf.Masked = true
+		}
+
+		node := tree
+		parts := strings.Split(key, ".")
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				node[part] = child
+			}
+			node = child
+		}
+		node[parts[len(parts)-1]] = leaf
+	}
+	return tree
+}
+
+func matchesAny(key string, patterns []string) bool {
+	key = strings.ToLower(key)
+	last := key[strings.LastIndex(key, ".")+1:]
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, last); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `
+config:
+  mask_patterns: ["*dsn"]
+server:
+  port: "8080"
+database:
+  password: hunter2
+  dsn: postgres://user:pass@db
+service:
+  api_key: key
+  name: orders
+feature:
+  token: plain
+  flag: ref
+`,
+	})
+	t.Setenv("FEATURE_FLAG", "secret://env#FLAG_VALUE")
+	t.Setenv("FLAG_VALUE", "from-secret")
+	Secrets.Invalidate()
+
+	c, err := New(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := c.Dump()
+	tests := []struct {
+		key    string
+		value  interface{}
+		masked bool
+		source string
+	}{
+		{key: "server.port", value: "8080", source: "config.yaml"},
+		{key: "service.name", value: "orders", source: "config.yaml"},
+		{key: "database.password", value: maskedValue, masked: true, source: "config.yaml"},
+		{key: "service.api_key", value: maskedValue, masked: true, source: "config.yaml"},
+		{key: "feature.token", value: maskedValue, masked: true, source: "config.yaml"},
+		{key: "database.dsn", value: maskedValue, masked: true, source: "config.yaml"},
+		{key: "feature.flag", value: maskedValue, masked: true, source: SourceEnv},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, ok := dumpLeaf(dump, tt.key)
+			if !ok {
+				t.Fatalf("%s not in dump", tt.key)
+			}
+			if got.Value != tt.value || got.Masked != tt.masked || got.Source != tt.source {
+				t.Errorf("leaf = %+v, want value %v, masked %v, source %s", got, tt.value, tt.masked, tt.source)
+			}
+		})
+	}
+}
+
+func dumpLeaf(tree map[string]interface{}, key string) (DumpValue, bool) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := tree[part].(map[string]interface{})
+		if !ok {
+			return DumpValue{}, false
+		}
+		tree = child
+	}
+	leaf, ok := tree[parts[len(parts)-1]].(DumpValue)
+	return leaf, ok
+}
@@ -0,0 +1,379 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Encrypted config values are written ENC[v2,<key id>,<base64 nonce+ciphertext>]
+// and sealed with AES-256-GCM, with the config key as additional data so a
+// value copied under another key does not decrypt. The elements of a list are
+// sealed with the key of the list. The key is a base64 encoded 32 byte key read
+// from CONFIG_ENCRYPTION_KEY or from the file named by
+// CONFIG_ENCRYPTION_KEY_FILE. While rotating, values sealed with previous keys
+// are opened with the comma separated keys of CONFIG_ENCRYPTION_OLD_KEYS.
+const (
+	envEncryptionKey     = "CONFIG_ENCRYPTION_KEY"
+	envEncryptionKeyFile = "CONFIG_ENCRYPTION_KEY_FILE"
+	envEncryptionOldKeys = "CONFIG_ENCRYPTION_OLD_KEYS"
+
+	encPrefix = "ENC["
+	// encVersion binds the sealed value to its config key
+	encVersion = "v2"
+)
+
+// KeyRing seals values with its primary key and opens values sealed with any of its keys
+type KeyRing struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// IsEncrypted reports whether value is an ENC[...] value
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encPrefix) && strings.HasSuffix(value, "]")
+}
+
+// GenerateKey returns a new base64 encoded key
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// NewKeyRing builds a key ring from base64 encoded keys, the first one is primary
+func NewKeyRing(primary string, old ...string) (*KeyRing, error) {
+	ring := &KeyRing{keys: map[string]cipher.AEAD{}}
+	for i, encoded := range append([]string{primary}, old...) {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("config: invalid encryption key: %w", err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil || len(key) != 32 {
+			return nil, errors.New("config: encryption keys must be 32 bytes")
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(key)
+		id := hex.EncodeToString(sum[:4])
+		ring.keys[id] = aead
+		if i == 0 {
+			ring.primary = id
+		}
+	}
+	return ring, nil
+}
+
+// LoadKeyRing builds the key ring from the CONFIG_ENCRYPTION_* env vars
+func LoadKeyRing() (*KeyRing, error) {
+	primary := os.Getenv(envEncryptionKey)
+	if file := os.Getenv(envEncryptionKeyFile); primary == "" && file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		primary = string(data)
+	}
+	if primary == "" {
+		return nil, fmt.Errorf("config: set %s or %s to use encrypted values", envEncryptionKey, envEncryptionKeyFile)
+	}
+	var old []string
+	if oldKeys := os.Getenv(envEncryptionOldKeys); oldKeys != "" {
+		old = strings.Split(oldKeys, ",")
+	}
+	return NewKeyRing(primary, old...)
+}
+
+// Encrypt seals plaintext, the value of the config key, with the primary key
+func (k *KeyRing) Encrypt(key, plaintext string) (string, error) {
+	aead := k.keys[k.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), additionalData(key))
+	return encPrefix + encVersion + "," + k.primary + "," + base64.StdEncoding.EncodeToString(sealed) + "]", nil
+}
+
+// Decrypt opens the ENC[...] value of the config key
+func (k *KeyRing) Decrypt(key, value string) (string, error) {
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, encPrefix), "]"), ",")
+	if len(parts) != 3 || parts[0] != encVersion {
+		return "", errors.New("config: malformed encrypted value")
+	}
+	aead, ok := k.keys[parts[1]]
+	if !ok {
+		return "", fmt.Errorf("config: no encryption key with id %s", parts[1])
+	}
+	sealed, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("config: malformed encrypted value")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData(key))
+	if err != nil {
+		return "", fmt.Errorf("config: could not decrypt value with key %s", parts[1])
+	}
+	return string(plaintext), nil
+}
+
+// decryptValues replaces the ENC[...] values of settings, including list
+// elements, with their plaintext
+func decryptValues(settings *viper.Viper, secretKeys map[string]bool) error {
+	var ring *KeyRing
+	verr := &ValidationError{}
+	for _, key := range settings.AllKeys() {
+		value := settings.Get(key)
+		if !hasEncrypted(value) {
+			continue
+		}
+		if ring == nil {
+			var err error
+			if ring, err = LoadKeyRing(); err != nil {
+				return err
+			}
+		}
+		plaintext, err := decryptValue(ring, key, value)
+		if err != nil {
+			verr.add(key, "%v", err)
+			continue
+		}
+		settings.Set(key, plaintext)
+		secretKeys[key] = true
+	}
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// hasEncrypted reports whether value or one of its list elements is encrypted
+func hasEncrypted(value interface{}) bool {
+	switch value := value.(type) {
+	case string:
+		return IsEncrypted(value)
+	case []interface{}:
+		for _, elem := range value {
+			if hasEncrypted(elem) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, elem := range value {
+			if hasEncrypted(elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decryptValue decrypts value of key like walkScalars visits it: list
+// elements under the key of the list, maps in lists under their own keys
+func decryptValue(ring *KeyRing, key string, value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		if !IsEncrypted(value) {
+			return value, nil
+		}
+		return ring.Decrypt(key, value)
+	case []interface{}:
+		out := make([]interface{}, len(value))
+		for i, elem := range value {
+			plaintext, err := decryptValue(ring, key, elem)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = plaintext
+		}
+		return out, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, elem := range value {
+			plaintext, err := decryptValue(ring, joinKey(key, strings.ToLower(k)), elem)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = plaintext
+		}
+		return out, nil
+	}
+	return value, nil
+}
+
+// EncryptFile encrypts the values of keys in the yaml file in place, every
+// element of a list key
+func EncryptFile(path string, ring *KeyRing, keys []string) error {
+	wanted := map[string]bool{}
+	for _, key := range keys {
+		wanted[strings.ToLower(key)] = true
+	}
+	found := map[string]bool{}
+	return rewriteFile(path, func(key, value string) (string, error) {
+		if !wanted[key] {
+			return value, nil
+		}
+		found[key] = true
+		if IsEncrypted(value) {
+			return value, nil
+		}
+		return ring.Encrypt(key, value)
+	}, func() error {
+		for key := range wanted {
+			if !found[key] {
+				return fmt.Errorf("config: %s has no string key %s", path, key)
+			}
+		}
+		return nil
+	})
+}
+
+// DecryptFile replaces every encrypted value of the yaml file with its plaintext in place
+func DecryptFile(path string, ring *KeyRing) error {
+	return rewriteFile(path, func(key, value string) (string, error) {
+		if !IsEncrypted(value) {
+			return value, nil
+		}
+		return ring.Decrypt(key, value)
+	}, nil)
+}
+
+// RotateFile re-encrypts every encrypted value of the yaml file with the
+// primary key of ring. Values sealed with an old key of ring are opened with it.
+func RotateFile(path string, ring *KeyRing) error {
+	return rewriteFile(path, func(key, value string) (string, error) {
+		if !IsEncrypted(value) {
+			return value, nil
+		}
+		plaintext, err := ring.Decrypt(key, value)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", key, err)
+		}
+		return ring.Encrypt(key, plaintext)
+	}, nil)
+}
+
+// additionalData binds a sealed value to its lowercased dotted config key
+func additionalData(key string) []byte {
+	return []byte(strings.ToLower(key))
+}
+
+// rewriteFile applies fn to every string scalar of a yaml file, keeping its
+// comments and layout, and replaces the file with the result
+func rewriteFile(path string, fn func(key, value string) (string, error), check func() error) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if err := walkScalars(&doc, "", fn); err != nil {
+		return err
+	}
+	if check != nil {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	return replaceFile(path, out.Bytes(), info.Mode().Perm())
+}
+
+// replaceFile writes data to a temporary file next to path and renames it
+// over path, so readers see the old or the new file and never a partial one
+func replaceFile(path string, data []byte, mode os.FileMode) (err error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// persist the rename
+	if d, derr := os.Open(dir); derr == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+func walkScalars(node *yaml.Node, key string, fn func(key, value string) (string, error)) error {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		// list elements take the key of their list
+		for _, child := range node.Content {
+			if err := walkScalars(child, key, fn); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := walkScalars(node.Content[i+1], joinKey(key, strings.ToLower(node.Content[i].Value)), fn); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if node.Tag != "!!str" {
+			return nil
+		}
+		value, err := fn(key, node.Value)
+		if err != nil {
+			return err
+		}
+		if value != node.Value {
+			node.Value = value
+			node.Style = 0
+		}
+	}
+	return nil
+}
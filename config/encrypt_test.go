@@ -0,0 +1,143 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	oldKey, _ := GenerateKey()
+	newKey, _ := GenerateKey()
+	oldRing, err := NewKeyRing(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring, err := NewKeyRing(newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _ := GenerateKey()
+	otherRing, _ := NewKeyRing(otherKey)
+
+	sealedOld, _ := oldRing.Encrypt("database.password", "rotated")
+	sealed, _ := ring.Encrypt("database.password", "s3cr3t")
+	parts := strings.Split(strings.TrimSuffix(sealed, "]"), ",")
+	tampered := parts[0] + "," + parts[1] + "," + "A" + parts[2][1:] + "]"
+
+	tests := []struct {
+		name    string
+		ring    *KeyRing
+		key     string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "primary key", ring: ring, key: "database.password", value: sealed, want: "s3cr3t"},
+		{name: "key case", ring: ring, key: "DATABASE.Password", value: sealed, want: "s3cr3t"},
+		{name: "old key", ring: ring, key: "database.password", value: sealedOld, want: "rotated"},
+		{name: "moved to another key", ring: ring, key: "admin.token", value: sealed, wantErr: true},
+		{name: "unknown key", ring: otherRing, key: "database.password", value: sealed, wantErr: true},
+		{name: "tampered", ring: ring, key: "database.password", value: tampered, wantErr: true},
+		{name: "wrong version", ring: ring, key: "database.password", value: strings.Replace(sealed, "v2", "v1", 1), wantErr: true},
+		{name: "malformed", ring: ring, key: "database.password", value: "ENC[v2,abc]", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !IsEncrypted(tt.value) {
+				t.Fatalf("IsEncrypted(%q) = false", tt.value)
+			}
+			got, err := tt.ring.Decrypt(tt.key, tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Decrypt = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decrypt: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Decrypt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewKeyRingRejectsShortKeys(t *testing.T) {
+	for _, key := range []string{"not base64!", "c2hvcnQ="} {
+		if _, err := NewKeyRing(key); err == nil {
+			t.Errorf("NewKeyRing(%q) succeeded, want an error", key)
+		}
+	}
+}
+
+func TestEncryptFile(t *testing.T) {
+	key, _ := GenerateKey()
+	ring, _ := NewKeyRing(key)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("# creds\ndatabase:\n  password: s3cr3t\n  user: app\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EncryptFile(path, ring, []string{"database.password"}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "s3cr3t") || !strings.Contains(string(data), "# creds") || !strings.Contains(string(data), "user: app") {
+		t.Errorf("encrypted file =\n%s", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o640 {
+		t.Errorf("mode = %v, want 0640", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("dir has %d entries, want the config file only", len(entries))
+	}
+
+	if err := DecryptFile(path, ring); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "password: s3cr3t") {
+		t.Errorf("decrypted file =\n%s", data)
+	}
+	if err := EncryptFile(path, ring, []string{"database.missing"}); err == nil {
+		t.Error("EncryptFile of a missing key succeeded")
+	}
+}
+
+func TestEncryptedList(t *testing.T) {
+	key, _ := GenerateKey()
+	ring, _ := NewKeyRing(key)
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": "database:\n  hosts:\n    replicas:\n      - replica-1\n      - replica-2\n    master: primary\n",
+	})
+	path := filepath.Join(dir, "config.yaml")
+	if err := EncryptFile(path, ring, []string{"database.hosts.replicas"}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "replica-") || !strings.Contains(string(data), "master: primary") {
+		t.Fatalf("encrypted file =\n%s", data)
+	}
+
+	t.Setenv(envEncryptionKey, key)
+	c, err := New(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Viper().GetStringSlice("database.hosts.replicas"); strings.Join(got, ",") != "replica-1,replica-2" {
+		t.Errorf("replicas = %v, want the decrypted list", got)
+	}
+	if !c.IsSecret("database.hosts.replicas") {
+		t.Error("database.hosts.replicas not reported as a secret")
+	}
+
+	if err := DecryptFile(path, ring); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "- replica-2") {
+		t.Errorf("decrypted file =\n%s", data)
+	}
+}
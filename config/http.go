@@ -1,12 +1,162 @@
 package config
 
+import (
+	"crypto/tls"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"go.uber.org/zap"
+)
+
 type HTTPConfig struct {
-	Port string
+	Port              string        `config:"port" validate:"required" desc:"port the HTTP server listens on"`
+	BasePath          string        `config:"base_path" desc:"path prefix of every route"`
+	ReadTimeout       time.Duration `config:"read_timeout" default:"30s" desc:"maximum duration for reading a request including its body"`
+	ReadHeaderTimeout time.Duration `config:"read_header_timeout" default:"10s" desc:"maximum duration for reading request headers"`
+	WriteTimeout      time.Duration `config:"write_timeout" default:"30s" desc:"maximum duration before timing out writes of the response"`
+	IdleTimeout       time.Duration `config:"idle_timeout" default:"120s" desc:"maximum time to wait for the next request on a keep-alive connection"`
+	MaxHeaderBytes    int           `config:"max_header_bytes" default:"1048576" validate:"min=1024" desc:"maximum size of request headers"`
+	TrustedProxies    []string      `config:"trusted_proxies" desc:"proxy IPs or CIDRs whose forwarding headers gin trusts for ClientIP, none when empty"`
+	TLS               TLSConfig     `config:"tls"`
+}
+
+type TLSConfig struct {
+	CertFile   string `config:"cert_file" desc:"PEM certificate, enables TLS together with key_file"`
+	KeyFile    string `config:"key_file" desc:"PEM private key of cert_file"`
+	MinVersion string `config:"min_version" default:"1.2" validate:"oneof=1.2 1.3" desc:"minimum TLS version"`
+	// ReloadInterval is how often the files are checked for a renewed certificate
+	ReloadInterval time.Duration `config:"reload_interval" default:"1m" desc:"how often the certificate files are checked for changes"`
+}
+
+// Check validates the rules spanning several fields
+func (c *HTTPConfig) Check() []FieldError {
+	var errs []FieldError
+	if c.BasePath != "" && !strings.HasPrefix(c.BasePath, "/") {
+		errs = append(errs, FieldError{Key: "base_path", Message: "must start with /"})
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, FieldError{Key: "tls", Message: "cert_file and key_file must be set together"})
+	}
+	return errs
+}
+
+// CheckRuntime checks the TLS files exist
+func (c *HTTPConfig) CheckRuntime() []FieldError {
+	var errs []FieldError
+	for _, file := range []string{c.TLS.CertFile, c.TLS.KeyFile} {
+		if _, err := os.Stat(file); file != "" && err != nil {
+			errs = append(errs, FieldError{Key: "tls", Message: err.Error()})
+		}
+	}
+	return errs
 }
 
-// LoadHTTPConfig returns server config
+// LoadHTTPConfigE returns server config, with every invalid key in the error
+func LoadHTTPConfigE() (HTTPConfig, error) {
+	return Load[HTTPConfig](LoadOptions{Prefix: "server"})
+}
+
+// Deprecated: use LoadHTTPConfigE, LoadHTTPConfig logs the invalid keys and
+// returns the config loaded from the others
 func LoadHTTPConfig() HTTPConfig {
-	return HTTPConfig{
-		Port: CFG.V.GetString("server.port"),
+	cfg, err := LoadHTTPConfigE()
+	if err != nil {
+		logger.Error("invalid server config", zap.Error(err))
+	}
+	return cfg
+}
+
+// NewServer builds an *http.Server serving handler with the configured
+// timeouts. When TLS is configured the certificate is reloaded as its files
+// change; start the server with ListenAndServeTLS("", "").
+func (c HTTPConfig) NewServer(handler http.Handler) (*http.Server, error) {
+	server := &http.Server{
+		Addr:              ":" + c.Port,
+		Handler:           handler,
+		ReadTimeout:       c.ReadTimeout,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+	}
+	if c.TLS.CertFile == "" {
+		return server, nil
+	}
+
+	reloader := &certReloader{certFile: c.TLS.CertFile, keyFile: c.TLS.KeyFile, interval: c.TLS.ReloadInterval}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	minVersion := uint16(tls.VersionTLS12)
+	if c.TLS.MinVersion == "1.3" {
+		minVersion = tls.VersionTLS13
+	}
+	server.TLSConfig = &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: reloader.getCertificate,
+	}
+	return server, nil
+}
+
+// ApplyGin sets the trusted proxies of engine and returns the group routes
+// should be registered on, rooted at the base path
+func (c HTTPConfig) ApplyGin(engine *gin.Engine) (*gin.RouterGroup, error) {
+	if err := engine.SetTrustedProxies(c.TrustedProxies); err != nil {
+		return nil, err
+	}
+	return engine.Group(c.BasePath), nil
+}
+
+// certReloader serves the certificate of certFile and keyFile, reloading it
+// when the files change
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checked) >= r.interval {
+		r.checked = time.Now()
+		if info, err := os.Stat(r.certFile); err == nil && info.ModTime().After(r.modTime) {
+			if err := r.reload(); err != nil {
+				logger.Error("could not reload TLS certificate, serving the previous one", zap.Error(err))
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+func (r *certReloader) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checked = time.Now()
+	return r.reload()
+}
+
+func (r *certReloader) reload() error {
+	info, err := os.Stat(r.certFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
 	}
+	r.cert = &cert
+	r.modTime = info.ModTime()
+	logger.Info("loaded TLS certificate", zap.String("cert_file", r.certFile))
+	return nil
 }
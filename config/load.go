@@ -0,0 +1,369 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// LoadOptions configures Load
+type LoadOptions struct {
+	// Prefix is prepended to every key of the struct, e.g. "server"
+	Prefix string
+	// Viper is read instead of the default configuration when set
+	Viper *viper.Viper
+}
+
+// FieldError is a missing or invalid config key
+type FieldError struct {
+	Key     string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Key + ": " + e.Message
+}
+
+// Checker is implemented by config structs with rules spanning several
+// fields. Load calls Check once every field is valid, keys are relative to
+// the prefix.
+type Checker interface {
+	Check() []FieldError
+}
+
+// RuntimeChecker is implemented by config structs with rules that depend on
+// the environment the service runs in, such as files that must exist or
+// secrets supplied at deploy time. Load calls CheckRuntime after Check,
+// Validate does not, ValidateRuntime does.
+type RuntimeChecker interface {
+	CheckRuntime() []FieldError
+}
+
+// ValidationError lists every missing or invalid key found while loading
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		lines[i] = "  " + fieldErr.Error()
+	}
+	return "invalid configuration:\n" + strings.Join(lines, "\n")
+}
+
+func (e *ValidationError) add(key, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+// Load unmarshals config into T and runs its Check and CheckRuntime. Fields are described by tags:
+//
+//	config:"port"              key relative to the prefix, defaults to the lowercased field name
+//	default:"8080"             value used when the key is not set
+//	validate:"required,min=1,max=65535,oneof=a b"
+//
+// required needs the key set, and strings, slices and maps not empty: a false
+// bool or a 0 set explicitly is accepted.
+// min and max bound numbers and the length of strings and slices. Pointer
+// fields stay nil when the key is not set and has no default. Nested
+// structs are loaded from the sub tree of their key, maps of structs from a
+// sub tree per map key. Viper lowercases the map keys. Every problem is
+// collected into a single *ValidationError.
+func Load[T any](opts LoadOptions) (T, error) {
+	if opts.Viper == nil {
+		opts.Viper = Default().Viper()
+	}
+	return load[T](opts, true)
+}
+
+// load is Load without the CFG fallback, usable while CFG is initialised.
+// CheckRuntime runs only when runtime is set.
+func load[T any](opts LoadOptions, runtime bool) (T, error) {
+	var out T
+	value := reflect.ValueOf(&out).Elem()
+	if value.Kind() != reflect.Struct {
+		return out, fmt.Errorf("config: Load needs a struct, got %T", out)
+	}
+	verr := &ValidationError{}
+	loadStruct(opts.Viper, opts.Prefix, value, verr)
+	if checker, ok := value.Addr().Interface().(Checker); ok && len(verr.Errors) == 0 {
+		for _, fieldErr := range checker.Check() {
+			verr.add(joinKey(opts.Prefix, fieldErr.Key), "%s", fieldErr.Message)
+		}
+	}
+	if checker, ok := value.Addr().Interface().(RuntimeChecker); ok && runtime && len(verr.Errors) == 0 {
+		for _, fieldErr := range checker.CheckRuntime() {
+			verr.add(joinKey(opts.Prefix, fieldErr.Key), "%s", fieldErr.Message)
+		}
+	}
+	if len(verr.Errors) > 0 {
+		return out, verr
+	}
+	return out, nil
+}
+
+// MustLoad is Load that panics on any error, for use at startup
+func MustLoad[T any](opts LoadOptions) T {
+	out, err := Load[T](opts)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func loadStruct(v *viper.Viper, prefix string, value reflect.Value, verr *ValidationError) {
+	for _, field := range structFields(value.Type()) {
+		key := joinKey(prefix, field.key)
+		target := value.FieldByIndex(field.index)
+		if target.Kind() == reflect.Struct && target.Type() != reflect.TypeOf(time.Time{}) {
+			loadStruct(v, key, target, verr)
+			continue
+		}
+		if isStructMap(target.Type()) {
+			loadStructMap(v, key, target, verr)
+			validateField(key, target, field.rules, v.IsSet(key), verr)
+			continue
+		}
+
+		var raw interface{}
+		if v.IsSet(key) {
+			raw = v.Get(key)
+		} else if field.def != "" {
+			raw = field.def
+		}
+		if raw != nil {
+			if err := setValue(target, raw); err != nil {
+				verr.add(key, "invalid value %q: %v", fmt.Sprint(raw), err)
+				continue
+			}
+		}
+		validateField(key, target, field.rules, raw != nil, verr)
+	}
+}
+
+// loadStructMap loads a struct per sub key of prefix into target, checking
+// those implementing Checker
+func loadStructMap(v *viper.Viper, prefix string, target reflect.Value, verr *ValidationError) {
+	names := v.GetStringMap(prefix)
+	if len(names) == 0 {
+		return
+	}
+	out := reflect.MakeMapWithSize(target.Type(), len(names))
+	for name := range names {
+		key := joinKey(prefix, name)
+		elem := reflect.New(target.Type().Elem()).Elem()
+		before := len(verr.Errors)
+		loadStruct(v, key, elem, verr)
+		if checker, ok := elem.Addr().Interface().(Checker); ok && len(verr.Errors) == before {
+			for _, fieldErr := range checker.Check() {
+				verr.add(joinKey(key, fieldErr.Key), "%s", fieldErr.Message)
+			}
+		}
+		out.SetMapIndex(reflect.ValueOf(name), elem)
+	}
+	target.Set(out)
+}
+
+// isStructMap reports whether t is a map of structs keyed by string
+func isStructMap(t reflect.Type) bool {
+	return t.Kind() == reflect.Map && t.Key().Kind() == reflect.String &&
+		t.Elem().Kind() == reflect.Struct && t.Elem() != reflect.TypeOf(time.Time{})
+}
+
+// configField is a struct field with its parsed tags
+type configField struct {
+	name  string
+	index []int
+	key   string
+	def   string
+	desc  string
+	rules map[string]string
+}
+
+func structFields(t reflect.Type) []configField {
+	var fields []configField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("config")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = strings.ToLower(f.Name)
+		}
+		fields = append(fields, configField{
+			name:  f.Name,
+			index: f.Index,
+			key:   tag,
+			def:   f.Tag.Get("default"),
+			desc:  f.Tag.Get("desc"),
+			rules: parseRules(f.Tag.Get("validate")),
+		})
+	}
+	return fields
+}
+
+func parseRules(tag string) map[string]string {
+	rules := map[string]string{}
+	for _, rule := range strings.Split(tag, ",") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(rule, "=")
+		rules[name] = arg
+	}
+	return rules
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func setValue(target reflect.Value, raw interface{}) error {
+	if target.Kind() == reflect.Pointer {
+		elem := reflect.New(target.Type().Elem())
+		if err := setValue(elem.Elem(), raw); err != nil {
+			return err
+		}
+		target.Set(elem)
+		return nil
+	}
+	if target.Type() == durationType {
+		d, err := cast.ToDurationE(raw)
+		target.SetInt(int64(d))
+		return err
+	}
+	switch target.Kind() {
+	case reflect.String:
+		s, err := cast.ToStringE(raw)
+		target.SetString(s)
+		return err
+	case reflect.Bool:
+		b, err := cast.ToBoolE(raw)
+		target.SetBool(b)
+		return err
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := cast.ToInt64E(raw)
+		target.SetInt(n)
+		return err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := cast.ToUint64E(raw)
+		target.SetUint(n)
+		return err
+	case reflect.Float32, reflect.Float64:
+		n, err := cast.ToFloat64E(raw)
+		target.SetFloat(n)
+		return err
+	case reflect.Slice:
+		if s, ok := raw.(string); ok {
+			raw = strings.Split(s, ",")
+		}
+		items := reflect.ValueOf(raw)
+		if items.Kind() != reflect.Slice {
+			return fmt.Errorf("expected a list")
+		}
+		out := reflect.MakeSlice(target.Type(), items.Len(), items.Len())
+		for i := 0; i < items.Len(); i++ {
+			if err := setValue(out.Index(i), items.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		target.Set(out)
+		return nil
+	case reflect.Map:
+		items, err := cast.ToStringMapE(raw)
+		if err != nil {
+			return err
+		}
+		out := reflect.MakeMapWithSize(target.Type(), len(items))
+		for k, item := range items {
+			elem := reflect.New(target.Type().Elem()).Elem()
+			if err := setValue(elem, item); err != nil {
+				return err
+			}
+			out.SetMapIndex(reflect.ValueOf(k), elem)
+		}
+		target.Set(out)
+		return nil
+	}
+	return fmt.Errorf("unsupported field type %s", target.Type())
+}
+
+func validateField(key string, value reflect.Value, rules map[string]string, set bool, verr *ValidationError) {
+	if _, ok := rules["required"]; ok && (!set || isEmpty(value)) {
+		verr.add(key, "is required")
+		return
+	}
+	if !set {
+		return
+	}
+	if value.Kind() == reflect.Pointer {
+		value = value.Elem()
+	}
+
+	size, sized := fieldSize(value)
+	if arg, ok := rules["min"]; ok && sized && size < parseBound(value, arg) {
+		verr.add(key, "must be at least %s", arg)
+	}
+	if arg, ok := rules["max"]; ok && sized && size > parseBound(value, arg) {
+		verr.add(key, "must be at most %s", arg)
+	}
+	if arg, ok := rules["oneof"]; ok {
+		allowed := strings.Fields(arg)
+		current := fmt.Sprint(value.Interface())
+		found := false
+		for _, a := range allowed {
+			found = found || a == current
+		}
+		if !found {
+			verr.add(key, "must be one of %s, got %q", strings.Join(allowed, ", "), current)
+		}
+	}
+}
+
+// isEmpty reports whether value is an empty string, slice or map
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	case reflect.Pointer:
+		return value.IsNil()
+	}
+	return false
+}
+
+// parseBound reads a min or max argument, as a duration for duration fields
+func parseBound(value reflect.Value, arg string) float64 {
+	if value.Type() == durationType {
+		d, _ := time.ParseDuration(arg)
+		return float64(d)
+	}
+	bound, _ := strconv.ParseFloat(arg, 64)
+	return bound
+}
+
+// fieldSize is the number compared by min and max: the value of numbers and
+// the length of strings, slices and maps
+func fieldSize(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	case reflect.String, reflect.Slice, reflect.Map:
+		return float64(value.Len()), true
+	}
+	return 0, false
+}
@@ -0,0 +1,279 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type testServer struct {
+	Host    string        `config:"host" default:"localhost"`
+	Port    int           `config:"port" validate:"required,min=1,max=65535"`
+	Mode    string        `config:"mode" default:"http" validate:"oneof=http https"`
+	Timeout time.Duration `config:"timeout" default:"5s" validate:"min=1s"`
+	Origins []string      `config:"origins"`
+	Limits  testLimits    `config:"limits"`
+	TLSCert string        `config:"tls_cert"`
+	TLSKey  string        `config:"tls_key"`
+}
+
+type testLimits struct {
+	Burst int `config:"burst" default:"10" validate:"min=1"`
+}
+
+func (s *testServer) Check() []FieldError {
+	if (s.TLSCert == "") != (s.TLSKey == "") {
+		return []FieldError{{Key: "tls_key", Message: "must be set with tls_cert"}}
+	}
+	return nil
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		want     testServer
+		errKeys  []string
+	}{
+		{
+			name:     "defaults",
+			settings: map[string]interface{}{"server.port": 8080},
+			want:     testServer{Host: "localhost", Port: 8080, Mode: "http", Timeout: 5 * time.Second, Limits: testLimits{Burst: 10}},
+		},
+		{
+			name: "set values",
+			settings: map[string]interface{}{
+				"server.host":         "0.0.0.0",
+				"server.port":         "443",
+				"server.mode":         "https",
+				"server.timeout":      "1m",
+				"server.origins":      "a.example,b.example",
+				"server.limits.burst": 3,
+			},
+			want: testServer{Host: "0.0.0.0", Port: 443, Mode: "https", Timeout: time.Minute, Origins: []string{"a.example", "b.example"}, Limits: testLimits{Burst: 3}},
+		},
+		{
+			name:     "missing required",
+			settings: map[string]interface{}{},
+			errKeys:  []string{"server.port"},
+		},
+		{
+			name: "every invalid key",
+			settings: map[string]interface{}{
+				"server.port":         70000,
+				"server.mode":         "ftp",
+				"server.timeout":      "10ms",
+				"server.limits.burst": 0,
+			},
+			errKeys: []string{"server.port", "server.mode", "server.timeout", "server.limits.burst"},
+		},
+		{
+			name:     "unparsable value",
+			settings: map[string]interface{}{"server.port": "http"},
+			errKeys:  []string{"server.port"},
+		},
+		{
+			name:     "check",
+			settings: map[string]interface{}{"server.port": 443, "server.tls_cert": "cert.pem"},
+			errKeys:  []string{"server.tls_key"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			for key, value := range tt.settings {
+				v.Set(key, value)
+			}
+			got, err := Load[testServer](LoadOptions{Prefix: "server", Viper: v})
+			if len(tt.errKeys) > 0 {
+				if keys := errorKeys(t, err); !reflect.DeepEqual(keys, tt.errKeys) {
+					t.Fatalf("error keys = %v, want %v", keys, tt.errKeys)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRequired(t *testing.T) {
+	type feature struct {
+		Enabled bool     `config:"enabled" validate:"required"`
+		Limit   int      `config:"limit" validate:"required"`
+		Name    string   `config:"name" validate:"required"`
+		Tenants []string `config:"tenants" validate:"required"`
+	}
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		errKeys  []string
+	}{
+		{"missing", map[string]interface{}{}, []string{"enabled", "limit", "name", "tenants"}},
+		{"explicit zero values", map[string]interface{}{"enabled": false, "limit": 0, "name": "beta", "tenants": []string{"acme"}}, nil},
+		{"empty values", map[string]interface{}{"enabled": true, "limit": 1, "name": "", "tenants": []string{}}, []string{"name", "tenants"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			for key, value := range tt.settings {
+				v.Set(key, value)
+			}
+			_, err := Load[feature](LoadOptions{Viper: v})
+			if tt.errKeys == nil {
+				if err != nil {
+					t.Fatalf("Load = %v", err)
+				}
+				return
+			}
+			if keys := errorKeys(t, err); !reflect.DeepEqual(keys, tt.errKeys) {
+				t.Errorf("error keys = %v, want %v", keys, tt.errKeys)
+			}
+		})
+	}
+}
+
+func TestLoadPointer(t *testing.T) {
+	type rates struct {
+		Unset  *float64 `config:"unset"`
+		Zero   *float64 `config:"zero" default:"1" validate:"max=1"`
+		Bounds *float64 `config:"bounds" validate:"max=1"`
+	}
+	v := viper.New()
+	v.Set("zero", 0)
+	v.Set("bounds", 2)
+	_, err := Load[rates](LoadOptions{Viper: v})
+	if keys := errorKeys(t, err); !reflect.DeepEqual(keys, []string{"bounds"}) {
+		t.Fatalf("error keys = %v, want [bounds]", keys)
+	}
+
+	v.Set("bounds", 0.5)
+	got, err := Load[rates](LoadOptions{Viper: v})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Unset != nil || got.Zero == nil || *got.Zero != 0 || got.Bounds == nil || *got.Bounds != 0.5 {
+		t.Errorf("Load = unset %v, zero %v, bounds %v", got.Unset, got.Zero, got.Bounds)
+	}
+}
+
+func TestLoadNeedsStruct(t *testing.T) {
+	if _, err := Load[string](LoadOptions{Viper: viper.New()}); err == nil {
+		t.Error("Load[string] succeeded, want an error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := map[string]interface{}{
+		"ACCESS_SECRET":  "access",
+		"REFRESH_SECRET": "refresh",
+		"server.port":    8080,
+	}
+	tests := []struct {
+		name    string
+		extra   map[string]interface{}
+		unset   []string
+		errKeys []string
+	}{
+		{name: "valid"},
+		{name: "missing secret", unset: []string{"ACCESS_SECRET"}},
+		{name: "missing tls file", extra: map[string]interface{}{"server.tls.cert_file": "missing.pem", "server.tls.key_file": "missing.key"}},
+		{name: "invalid value", extra: map[string]interface{}{"log.level": "loud"}, errKeys: []string{"log.level"}},
+		{name: "unknown key", extra: map[string]interface{}{"server.prot": 8080}, errKeys: []string{"server.prot"}},
+		{
+			name:    "sorted errors",
+			extra:   map[string]interface{}{"server.base_path": "api", "log.level": "loud", "admin.enabled": true},
+			errKeys: []string{"admin.token", "log.level", "server.base_path"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(testViper(valid, tt.extra, tt.unset))
+			if len(tt.errKeys) == 0 {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if keys := errorKeys(t, err); !reflect.DeepEqual(keys, tt.errKeys) {
+				t.Fatalf("error keys = %v, want %v", keys, tt.errKeys)
+			}
+		})
+	}
+}
+
+func TestValidateRuntime(t *testing.T) {
+	valid := map[string]interface{}{
+		"ACCESS_SECRET":  "access",
+		"REFRESH_SECRET": "refresh",
+		"server.port":    8080,
+	}
+	tests := []struct {
+		name    string
+		extra   map[string]interface{}
+		unset   []string
+		errKeys []string
+	}{
+		{name: "valid"},
+		{name: "missing secrets", unset: []string{"ACCESS_SECRET", "REFRESH_SECRET"}, errKeys: []string{"ACCESS_SECRET", "REFRESH_SECRET"}},
+		{name: "missing tls file", extra: map[string]interface{}{"server.tls.cert_file": "missing.pem", "server.tls.key_file": "missing.key"}, errKeys: []string{"server.tls", "server.tls"}},
+		{name: "static and runtime errors", extra: map[string]interface{}{"server.base_path": "api"}, unset: []string{"ACCESS_SECRET"}, errKeys: []string{"ACCESS_SECRET", "server.base_path"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRuntime(testViper(valid, tt.extra, tt.unset))
+			if len(tt.errKeys) == 0 {
+				if err != nil {
+					t.Fatalf("ValidateRuntime: %v", err)
+				}
+				return
+			}
+			if keys := errorKeys(t, err); !reflect.DeepEqual(keys, tt.errKeys) {
+				t.Fatalf("error keys = %v, want %v", keys, tt.errKeys)
+			}
+		})
+	}
+}
+
+// testViper sets valid without the unset keys, then extra
+func testViper(valid, extra map[string]interface{}, unset []string) *viper.Viper {
+	v := viper.New()
+	for key, value := range valid {
+		if !contains(unset, key) {
+			v.Set(key, value)
+		}
+	}
+	for key, value := range extra {
+		v.Set(key, value)
+	}
+	return v
+}
+
+func errorKeys(t *testing.T, err error) []string {
+	t.Helper()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("error = %v, want a *ValidationError", err)
+	}
+	keys := make([]string, len(verr.Errors))
+	for i, fieldErr := range verr.Errors {
+		keys[i] = fieldErr.Key
+	}
+	return keys
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type LogConfig struct {
+	Level       string            `config:"level" default:"info" validate:"oneof=debug info warn error dpanic panic fatal" desc:"minimum enabled level"`
+	Encoding    string            `config:"encoding" default:"json" validate:"oneof=json console" desc:"log line encoding"`
+	OutputPaths []string          `config:"output_paths" desc:"files or stdout/stderr the logs are written to, stderr when empty"`
+	Development bool              `config:"development" desc:"use zap's development config, with console friendly output and stack traces on warnings"`
+	Packages    map[string]string `config:"packages" desc:"level overrides of named loggers, by logger name"`
+	Sampling    LogSamplingConfig `config:"sampling"`
+}
+
+type LogSamplingConfig struct {
+	Initial    int `config:"initial" default:"100" validate:"min=0" desc:"entries with the same level and message logged each second before sampling, 0 disables sampling"`
+	Thereafter int `config:"thereafter" default:"100" validate:"min=1" desc:"every how many entries one is logged once initial is reached"`
+}
+
+// Check validates the level overrides
+func (c *LogConfig) Check() []FieldError {
+	var errs []FieldError
+	for name, level := range c.Packages {
+		if _, err := zapcore.ParseLevel(level); err != nil {
+			errs = append(errs, FieldError{Key: "packages." + name, Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// Options returns the logger options of c
+func (c LogConfig) Options() logger.Options {
+	return logger.Options{
+		Level:       c.Level,
+		Encoding:    c.Encoding,
+		OutputPaths: c.OutputPaths,
+		Development: c.Development,
+		Packages:    c.Packages,
+		Sampling:    &zap.SamplingConfig{Initial: c.Sampling.Initial, Thereafter: c.Sampling.Thereafter},
+	}
+}
+
+// LoadLogConfig returns log config, with every invalid key in the error
+func LoadLogConfig() (LogConfig, error) {
+	return Load[LogConfig](LoadOptions{Prefix: "log"})
+}
+
+// ConfigureLogger builds the default logger from the log section of c and
+// keeps log.level and log.packages applied as the config is reloaded. Changing
+// the encoding, outputs or sampling takes a restart.
+func (c *Configuration) ConfigureLogger() error {
+	cfg, err := Load[LogConfig](LoadOptions{Prefix: "log", Viper: c.Viper()})
+	if err != nil {
+		return err
+	}
+	l, err := logger.New(cfg.Options())
+	if err != nil {
+		return err
+	}
+	logger.SetDefault(l)
+
+	c.AddValidator(func(v *viper.Viper) error {
+		_, err := Load[LogConfig](LoadOptions{Prefix: "log", Viper: v})
+		return err
+	})
+	c.Watch("log", func(_, _ interface{}) {
+		cfg, err := Load[LogConfig](LoadOptions{Prefix: "log", Viper: c.Viper()})
+		if err == nil {
+			err = logger.SetLevel(cfg.Level)
+		}
+		if err == nil {
+			err = logger.SetPackageLevels(cfg.Packages)
+		}
+		if err != nil {
+			logger.Error("could not apply log config", zap.Error(err))
+			return
+		}
+		logger.Info("log level changed", zap.String("level", cfg.Level), zap.Any("packages", cfg.Packages))
+	})
+	return nil
+}
@@ -0,0 +1,30 @@
+package config
+
+// MetricsConfig configures the Prometheus request metrics and their endpoint
+type MetricsConfig struct {
+	Enabled   bool      `config:"enabled" default:"true" desc:"record request metrics"`
+	Path      string    `config:"path" default:"/metrics" desc:"path the metrics are served on"`
+	Namespace string    `config:"namespace" desc:"prefix of the metric names"`
+	SkipPaths []string  `config:"skip_paths" desc:"request paths not recorded, such as health checks"`
+	Buckets   []float64 `config:"buckets" default:"0.005,0.01,0.025,0.05,0.1,0.25,0.5,1,2.5,5,10" desc:"upper bounds in seconds of the latency histogram buckets"`
+	// BasePath prefixes Path and SkipPaths when the routes are mounted under
+	// it. LoadMetricsConfig sets it to server.base_path.
+	BasePath string `config:"-"`
+}
+
+// Check validates the buckets are increasing
+func (c *MetricsConfig) Check() []FieldError {
+	for i := 1; i < len(c.Buckets); i++ {
+		if c.Buckets[i] <= c.Buckets[i-1] {
+			return []FieldError{{Key: "buckets", Message: "must be increasing"}}
+		}
+	}
+	return nil
+}
+
+// LoadMetricsConfig returns metrics config, with every invalid key in the error
+func LoadMetricsConfig() (MetricsConfig, error) {
+	cfg, err := Load[MetricsConfig](LoadOptions{Prefix: "metrics"})
+	cfg.BasePath = Default().Viper().GetString("server.base_path")
+	return cfg, err
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// section is a typed config struct loaded from prefix
+type section struct {
+	prefix   string
+	typ      reflect.Type
+	validate func(v *viper.Viper, runtime bool) error
+}
+
+var sections = []section{
+	newSection[AuthConfig](""),
+	newSection[HTTPConfig]("server"),
+	newSection[LogConfig]("log"),
+	newSection[TracingConfig]("tracing"),
+	newSection[MetricsConfig]("metrics"),
+	newSection[AdminConfig]("admin"),
+}
+
+func newSection[T any](prefix string) section {
+	return section{
+		prefix: prefix,
+		typ:    reflect.TypeOf((*T)(nil)).Elem(),
+		validate: func(v *viper.Viper, runtime bool) error {
+			_, err := load[T](LoadOptions{Prefix: prefix, Viper: v}, runtime)
+			return err
+		},
+	}
+}
+
+// RegisterSection adds T, loaded from prefix, to Schema and Validate.
+// Describe fields with a desc tag.
+func RegisterSection[T any](prefix string) {
+	sections = append(sections, newSection[T](prefix))
+}
+
+// Schema returns the JSON Schema of every registered section
+func Schema() map[string]interface{} {
+	root := objectSchema()
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["title"] = "hangover service configuration"
+	for _, s := range sections {
+		node := root
+		if s.prefix != "" {
+			for _, part := range strings.Split(strings.ToLower(s.prefix), ".") {
+				node = childSchema(node, part)
+			}
+		}
+		structSchema(node, s.typ)
+	}
+	return root
+}
+
+// Validate checks v against every registered section: values must load and
+// validate, and keys under a section prefix must be known fields. It checks
+// the config alone, see ValidateRuntime.
+func Validate(v *viper.Viper) error {
+	return validate(v, false)
+}
+
+// ValidateRuntime is Validate that also runs the RuntimeChecker rules, such
+// as the token secrets being set and the TLS files existing. Run it at
+// startup.
+func ValidateRuntime(v *viper.Viper) error {
+	return validate(v, true)
+}
+
+func validate(v *viper.Viper, runtime bool) error {
+	verr := &ValidationError{}
+	for _, s := range sections {
+		var sectionErr *ValidationError
+		if err := s.validate(v, runtime); errors.As(err, &sectionErr) {
+			verr.Errors = append(verr.Errors, sectionErr.Errors...)
+		} else if err != nil {
+			return err
+		}
+		if s.prefix == "" {
+			continue
+		}
+		known, open := knownKeys(s.typ, strings.ToLower(s.prefix))
+		for _, key := range v.AllKeys() {
+			if strings.HasPrefix(key, strings.ToLower(s.prefix)+".") && !known[key] && !underAny(key, open) {
+				verr.add(key, "unknown key")
+			}
+		}
+	}
+	if len(verr.Errors) == 0 {
+		return nil
+	}
+	sort.SliceStable(verr.Errors, func(i, j int) bool { return verr.Errors[i].Key < verr.Errors[j].Key })
+	return verr
+}
+
+func objectSchema() map[string]interface{} {
+	return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+}
+
+func childSchema(parent map[string]interface{}, name string) map[string]interface{} {
+	properties := parent["properties"].(map[string]interface{})
+	child, ok := properties[name].(map[string]interface{})
+	if !ok {
+		child = objectSchema()
+		properties[name] = child
+	}
+	return child
+}
+
+func structSchema(node map[string]interface{}, t reflect.Type) {
+	for _, field := range structFields(t) {
+		ft := t.FieldByIndex(field.index).Type
+		parent := node
+		parts := strings.Split(strings.ToLower(field.key), ".")
+		for _, part := range parts[:len(parts)-1] {
+			parent = childSchema(parent, part)
+		}
+		name := parts[len(parts)-1]
+
+		var prop map[string]interface{}
+		if ft.Kind() == reflect.Struct && ft != reflect.TypeOf(time.Time{}) {
+			prop = childSchema(parent, name)
+			structSchema(prop, ft)
+		} else {
+			prop = typeSchema(ft)
+			parent["properties"].(map[string]interface{})[name] = prop
+		}
+		if field.desc != "" {
+			prop["description"] = field.desc
+		}
+		if field.def != "" {
+			prop["default"] = schemaDefault(ft, field.def)
+		}
+		if _, ok := field.rules["required"]; ok {
+			required, _ := parent["required"].([]string)
+			parent["required"] = append(required, name)
+		}
+		addRuleSchema(prop, ft, field.rules)
+	}
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Pointer {
+		return typeSchema(t.Elem())
+	}
+	if t == durationType {
+		return map[string]interface{}{"type": "string", "pattern": `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		if isStructMap(t) {
+			item := objectSchema()
+			structSchema(item, t.Elem())
+			return map[string]interface{}{"type": "object", "additionalProperties": item}
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	}
+	return map[string]interface{}{"type": "string"}
+}
+
+func addRuleSchema(prop map[string]interface{}, t reflect.Type, rules map[string]string) {
+	if arg, ok := rules["oneof"]; ok {
+		prop["enum"] = strings.Fields(arg)
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	minKey, maxKey := "minimum", "maximum"
+	switch t.Kind() {
+	case reflect.String:
+		minKey, maxKey = "minLength", "maxLength"
+	case reflect.Slice:
+		minKey, maxKey = "minItems", "maxItems"
+	case reflect.Map:
+		minKey, maxKey = "minProperties", "maxProperties"
+	}
+	if t == durationType {
+		// bounds of durations are enforced by Validate only
+		return
+	}
+	if arg, ok := rules["min"]; ok {
+		prop[minKey], _ = strconv.ParseFloat(arg, 64)
+	}
+	if arg, ok := rules["max"]; ok {
+		prop[maxKey], _ = strconv.ParseFloat(arg, 64)
+	}
+}
+
+func schemaDefault(t reflect.Type, def string) interface{} {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	value := reflect.New(t).Elem()
+	if t == durationType || setValue(value, def) != nil {
+		return def
+	}
+	return value.Interface()
+}
+
+// sectionKeys returns the keys of every registered section
+func sectionKeys() []string {
+	var keys []string
+	for _, s := range sections {
+		known, _ := knownKeys(s.typ, strings.ToLower(s.prefix))
+		for key := range known {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// knownKeys returns the leaf keys of t under prefix and the prefixes of map
+// fields, which accept any sub key
+func knownKeys(t reflect.Type, prefix string) (map[string]bool, []string) {
+	known := map[string]bool{}
+	var open []string
+	for _, field := range structFields(t) {
+		key := joinKey(prefix, strings.ToLower(field.key))
+		ft := t.FieldByIndex(field.index).Type
+		switch {
+		case ft.Kind() == reflect.Struct && ft != reflect.TypeOf(time.Time{}):
+			nested, nestedOpen := knownKeys(ft, key)
+			for k := range nested {
+				known[k] = true
+			}
+			open = append(open, nestedOpen...)
+		case ft.Kind() == reflect.Map:
+			open = append(open, key)
+		default:
+			known[key] = true
+		}
+	}
+	return known, open
+}
+
+func underAny(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/robertantonyjaikumar/hangover-common/secrets"
+	"github.com/spf13/viper"
+)
+
+// Secrets resolves config values written as secret://<provider>/<path>#<key>.
+// The vault (files rendered to /vault/secrets by the vault agent) and env
+// providers are always available, more are declared under
+// secrets.providers.<name>. Type vault_kv reads a Vault KV v2 engine over HTTP:
+//
+//	secrets:
+//	  providers:
+//	    k8s: {type: dir, dir: /etc/secrets}
+//	    kv: {type: vault_kv, address: https://vault:8200, mount: secret, token_file: /vault/token}
+var Secrets = newSecretsResolver()
+
+type secretProviderConfig struct {
+	Type      string `config:"type" validate:"required,oneof=file env dir vault_kv"`
+	Dir       string `config:"dir"`
+	Ext       string `config:"ext"`
+	Address   string `config:"address"`
+	Mount     string `config:"mount"`
+	Namespace string `config:"namespace"`
+	TokenFile string `config:"token_file"`
+}
+
+func newSecretsResolver() *secrets.Resolver {
+	resolver := secrets.NewResolver()
+	resolver.Register("vault", secrets.FileProvider{Dir: "/vault/secrets"})
+	resolver.Register("env", secrets.EnvProvider{})
+	return resolver
+}
+
+// registerSecretProviders registers the providers declared in v
+func registerSecretProviders(v *viper.Viper) error {
+	for name := range v.GetStringMap("secrets.providers") {
+		cfg, err := load[secretProviderConfig](LoadOptions{Prefix: "secrets.providers." + name, Viper: v}, true)
+		if err != nil {
+			return err
+		}
+		switch cfg.Type {
+		case "file":
+			Secrets.Register(name, secrets.FileProvider{Dir: cfg.Dir, Ext: cfg.Ext})
+		case "env":
+			Secrets.Register(name, secrets.EnvProvider{})
+		case "dir":
+			Secrets.Register(name, secrets.DirProvider{Dir: cfg.Dir})
+		case "vault_kv":
+			Secrets.Register(name, secrets.VaultKVProvider{
+				Address:   cfg.Address,
+				Mount:     cfg.Mount,
+				Namespace: cfg.Namespace,
+				TokenFile: cfg.TokenFile,
+			})
+		}
+	}
+	return nil
+}
+
+// resolveSecrets replaces the secret references in the settings of read with
+// their values and puts the values of the env vars holding references in
+// read.env under their key, remembering the keys so they can be masked. Only
+// env vars naming a config key or a database env var are resolved, others are
+// left to their owners.
+func resolveSecrets(read layers) error {
+	settings, secretKeys := read.settings, read.secretKeys
+	if err := registerSecretProviders(settings); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	var verr ValidationError
+	for _, key := range settings.AllKeys() {
+		value, ok := settings.Get(key).(string)
+		if !ok || !secrets.IsRef(value) {
+			continue
+		}
+		secret, err := Secrets.Resolve(ctx, value)
+		if err != nil {
+			verr.add(key, "%v", err)
+			continue
+		}
+		settings.Set(key, secret.Reveal())
+		secretKeys[key] = true
+	}
+	keys := map[string]string{}
+	for _, key := range append(settings.AllKeys(), sectionKeys()...) {
+		keys[envName(key)] = key
+	}
+	for _, name := range databaseEnvNames(settings) {
+		keys[name] = strings.ToLower(name)
+	}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		key, ok := keys[name]
+		if !ok || !secrets.IsRef(value) {
+			continue
+		}
+		secret, err := Secrets.Resolve(ctx, value)
+		if err != nil {
+			verr.add(name, "%v", err)
+			continue
+		}
+		read.env[key] = secret.Reveal()
+		secretKeys[key] = true
+	}
+	if len(verr.Errors) > 0 {
+		return fmt.Errorf("could not resolve secrets: %w", &verr)
+	}
+	return nil
+}
+
+// IsSecret reports whether the value of key was resolved from a secret
+// reference or decrypted
+func (c *Configuration) IsSecret(key string) bool {
+	return c.snapshot().secretKeys[strings.ToLower(key)]
+}
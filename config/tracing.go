@@ -0,0 +1,33 @@
+package config
+
+// TracingConfig configures the tracer. Empty values of the datadog backend
+// fall back to the DD_* environment variables the tracer reads itself.
+type TracingConfig struct {
+	Backend        string            `config:"backend" default:"datadog" validate:"oneof=datadog otel none" desc:"telemetry backend: datadog, otel or none"`
+	Enabled        bool              `config:"enabled" desc:"start the tracer"`
+	Service        string            `config:"service" desc:"service name of the spans, service.name when empty"`
+	Env            string            `config:"env" desc:"environment of the spans"`
+	Version        string            `config:"version" desc:"version of the service"`
+	AgentAddr      string            `config:"agent_addr" desc:"host:port of the Datadog agent"`
+	SampleRate     float64           `config:"sample_rate" default:"1" validate:"min=0,max=1" desc:"share of traces kept"`
+	RuntimeMetrics bool              `config:"runtime_metrics" desc:"send Go runtime metrics"`
+	Tags           map[string]string `config:"tags" desc:"tags added to every span"`
+	OTLP           OTLPConfig        `config:"otlp"`
+}
+
+// OTLPConfig configures the span exporter of the otel backend
+type OTLPConfig struct {
+	Exporter string            `config:"exporter" default:"otlp" validate:"oneof=otlp stdout" desc:"otlp sends spans to a collector, stdout prints them for testing"`
+	Endpoint string            `config:"endpoint" default:"localhost:4318" desc:"host:port of the OTLP/HTTP collector"`
+	Insecure bool              `config:"insecure" default:"true" desc:"send spans over plain HTTP"`
+	Headers  map[string]string `config:"headers" desc:"headers sent with every export"`
+}
+
+// LoadTracingConfig returns tracing config, with every invalid key in the error
+func LoadTracingConfig() (TracingConfig, error) {
+	cfg, err := Load[TracingConfig](LoadOptions{Prefix: "tracing"})
+	if cfg.Service == "" {
+		cfg.Service = Default().GetServiceName()
+	}
+	return cfg, err
+}
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// DebounceInterval is how long config files must be quiet before a change is applied
+var DebounceInterval = 500 * time.Millisecond
+
+// watchState holds the subscriptions of a Configuration
+type watchState struct {
+	mu          sync.Mutex
+	watcher     *fsnotify.Watcher
+	timer       *time.Timer
+	keys        []keyWatch
+	subscribers []*subscriber
+	validators  []func(v *viper.Viper) error
+	// targets are the files the config file paths resolve to, a changed
+	// target is a symlink swap such as a ConfigMap update
+	targets map[string]string
+
+	// reload serialises Reload
+	reload sync.Mutex
+}
+
+type keyWatch struct {
+	key string
+	fn  func(old, new interface{})
+}
+
+// subscriber is a typed reload subscription, see Subscribe
+type subscriber struct {
+	validate func(v *viper.Viper) error
+	notify   func()
+}
+
+// Watch calls fn with the old and new value of key after a config file change
+// modifies it. The first call starts watching the config files.
+func (c *Configuration) Watch(key string, fn func(old, new interface{})) {
+	c.watch.mu.Lock()
+	c.watch.keys = append(c.watch.keys, keyWatch{key: key, fn: fn})
+	c.watch.mu.Unlock()
+	c.startWatching()
+}
+
+// AddValidator registers a check run against the candidate config of every
+// change. A change failing any check is rejected and the current config stays
+// active.
+func (c *Configuration) AddValidator(validate func(v *viper.Viper) error) {
+	c.watch.mu.Lock()
+	defer c.watch.mu.Unlock()
+	c.watch.validators = append(c.watch.validators, validate)
+}
+
+// Subscribe loads T like Load and calls fn with the old and new T whenever a
+// config file change modifies it. Changes that do not validate as T are
+// rejected.
+func Subscribe[T any](c *Configuration, opts LoadOptions, fn func(old, new T)) (T, error) {
+	opts.Viper = c.Viper()
+	current, err := Load[T](opts)
+	if err != nil {
+		return current, err
+	}
+
+	sub := &subscriber{
+		validate: func(v *viper.Viper) error {
+			candidate := opts
+			candidate.Viper = v
+			_, err := Load[T](candidate)
+			return err
+		},
+		notify: func() {
+			next, err := Load[T](LoadOptions{Prefix: opts.Prefix, Viper: c.Viper()})
+			if err != nil {
+				return
+			}
+			c.watch.mu.Lock()
+			if reflect.DeepEqual(current, next) {
+				c.watch.mu.Unlock()
+				return
+			}
+			old := current
+			current = next
+			c.watch.mu.Unlock()
+			fn(old, next)
+		},
+	}
+	c.watch.mu.Lock()
+	c.watch.subscribers = append(c.watch.subscribers, sub)
+	c.watch.mu.Unlock()
+	c.startWatching()
+	return current, nil
+}
+
+// StopWatch stops watching the config files
+func (c *Configuration) StopWatch() {
+	c.watch.mu.Lock()
+	defer c.watch.mu.Unlock()
+	if c.watch.timer != nil {
+		c.watch.timer.Stop()
+	}
+	if c.watch.watcher != nil {
+		c.watch.watcher.Close()
+		c.watch.watcher = nil
+	}
+}
+
+func (c *Configuration) startWatching() {
+	c.watch.mu.Lock()
+	defer c.watch.mu.Unlock()
+	if c.watch.watcher != nil {
+		return
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Error("could not watch config files", zap.Error(err))
+		return
+	}
+	if err := watcher.Add(c.dir); err != nil {
+		logger.Error("could not watch config files", zap.Error(err))
+		watcher.Close()
+		return
+	}
+	c.watch.watcher = watcher
+	c.watch.targets = c.layerTargets()
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// a ConfigMap or Secret update swaps the ..data symlink, no
+				// event names a config file
+				if c.isLayerFile(event.Name) || c.targetsChanged() {
+					c.debounce()
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Error("config watcher failed", zap.Error(err))
+			}
+		}
+	}()
+}
+
+// layerTargets returns the file each config file path resolves to
+func (c *Configuration) layerTargets() map[string]string {
+	targets := map[string]string{}
+	for _, name := range c.layerNames() {
+		for _, ext := range []string{".yaml", ".yml"} {
+			path := filepath.Join(c.dir, name+ext)
+			if target, err := filepath.EvalSymlinks(path); err == nil {
+				targets[path] = target
+			}
+		}
+	}
+	return targets
+}
+
+// targetsChanged reports whether a config file path resolves to another file
+// than before, and remembers the new targets
+func (c *Configuration) targetsChanged() bool {
+	targets := c.layerTargets()
+	c.watch.mu.Lock()
+	defer c.watch.mu.Unlock()
+	changed := !reflect.DeepEqual(targets, c.watch.targets)
+	c.watch.targets = targets
+	return changed
+}
+
+func (c *Configuration) isLayerFile(path string) bool {
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	if ext != ".yaml" && ext != ".yml" {
+		return false
+	}
+	name := strings.TrimSuffix(base, ext)
+	for _, layer := range c.layerNames() {
+		if name == layer {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Configuration) debounce() {
+	c.watch.mu.Lock()
+	defer c.watch.mu.Unlock()
+	if c.watch.timer != nil {
+		c.watch.timer.Stop()
+	}
+	c.watch.timer = time.AfterFunc(DebounceInterval, c.reload)
+}
+
+// Reload re-reads the config files into a new viper, validates it and swaps
+// it in, notifying subscribers of what changed. On error the current config
+// is kept.
+func (c *Configuration) Reload() error {
+	c.watch.reload.Lock()
+	defer c.watch.reload.Unlock()
+	read, err := c.readLayers()
+	if err != nil {
+		return err
+	}
+	candidate, err := c.build(read)
+	if err != nil {
+		return err
+	}
+	if err := c.validate(candidate); err != nil {
+		return err
+	}
+
+	c.watch.mu.Lock()
+	keys := append([]keyWatch(nil), c.watch.keys...)
+	subscribers := append([]*subscriber(nil), c.watch.subscribers...)
+	c.watch.mu.Unlock()
+
+	old := c.current.Swap(&snapshot{v: candidate, files: read.files, secretKeys: read.secretKeys})
+	if old == nil {
+		old = &snapshot{v: c.V}
+	}
+	for _, watch := range keys {
+		prev, next := old.v.Get(watch.key), candidate.Get(watch.key)
+		if !reflect.DeepEqual(prev, next) {
+			watch.fn(prev, next)
+		}
+	}
+	for _, sub := range subscribers {
+		sub.notify()
+	}
+	return nil
+}
+
+func (c *Configuration) reload() {
+	if err := c.Reload(); err != nil {
+		logger.Error("config change rejected, keeping the current config", zap.Error(err))
+		return
+	}
+	logger.Info("config reloaded")
+}
+
+// validate runs every validator against candidate
+func (c *Configuration) validate(candidate *viper.Viper) error {
+	c.watch.mu.Lock()
+	validators := append([]func(v *viper.Viper) error(nil), c.watch.validators...)
+	for _, sub := range c.watch.subscribers {
+		validators = append(validators, sub.validate)
+	}
+	c.watch.mu.Unlock()
+
+	var errs []error
+	for _, validate := range validators {
+		if err := validate(candidate); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type watchTestService struct {
+	Name string `config:"name"`
+}
+
+// configMapDir lays out dir like a mounted ConfigMap: config.yaml links to
+// ..data/config.yaml and ..data to a versioned directory
+func configMapDir(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeConfigMapVersion(t, dir, "..v1", content)
+	if err := os.Symlink("..data/config.yaml", filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// writeConfigMapVersion writes content to version and swaps ..data to it
+func writeConfigMapVersion(t *testing.T, dir, version, content string) {
+	t.Helper()
+	if err := os.Mkdir(filepath.Join(dir, version), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, version, "config.yaml"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(version, filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchConfigMapSwap(t *testing.T) {
+	interval := DebounceInterval
+	DebounceInterval = 10 * time.Millisecond
+	t.Cleanup(func() { DebounceInterval = interval })
+
+	dir := configMapDir(t, "service:\n  name: v1\n")
+	c, err := New(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.StopWatch)
+
+	changes := make(chan watchTestService, 1)
+	current, err := Subscribe(c, LoadOptions{Prefix: "service"}, func(_, next watchTestService) {
+		changes <- next
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Name != "v1" {
+		t.Fatalf("Name = %q, want v1", current.Name)
+	}
+
+	writeConfigMapVersion(t, dir, "..v2", "service:\n  name: v2\n")
+	select {
+	case next := <-changes:
+		if next.Name != "v2" {
+			t.Errorf("Name = %q, want v2", next.Name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("symlink swap not reloaded")
+	}
+}
+
+func TestSubscribeConcurrentReload(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{"config.yaml": "service:\n  name: v1\n"})
+	c, err := New(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.StopWatch)
+	var mu sync.Mutex
+	var seen []string
+	if _, err := Subscribe(c, LoadOptions{Prefix: "service"}, func(_, next watchTestService) {
+		mu.Lock()
+		seen = append(seen, next.Name)
+		mu.Unlock()
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("service:\n  name: v2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Reload(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 1 || seen[0] != "v2" {
+		t.Errorf("changes = %v, want a single change to v2", seen)
+	}
+}
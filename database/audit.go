@@ -0,0 +1,353 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/robertantonyjaikumar/hangover-common/claims"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"github.com/robertantonyjaikumar/hangover-common/requestid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+
+	auditBeforeKey = "audit:before"
+)
+
+// Audited opts a model into the audit trail when embedded in it.
+// Fields tagged `audit:"-"` are never recorded.
+type Audited struct{}
+
+func (Audited) audited() {}
+
+type auditable interface {
+	audited()
+}
+
+// AuditLog is a single audited change. Add it to the migrations of any
+// service that registers the AuditPlugin.
+type AuditLog struct {
+	ID        uint            `gorm:"primaryKey"`
+	Table     string          `gorm:"column:entity_table;index:idx_audit_entity"`
+	EntityID  string          `gorm:"index:idx_audit_entity"`
+	Action    string          `gorm:"size:16"`
+	Before    json.RawMessage `gorm:"type:jsonb"`
+	After     json.RawMessage `gorm:"type:jsonb"`
+	Diff      json.RawMessage `gorm:"type:jsonb"`
+	TenantID  string          `gorm:"index"`
+	SessionID string
+	RoleID    string
+	RequestID string
+	CreatedAt time.Time
+}
+
+// AuditChange is the old and new value of a field in AuditLog.Diff
+type AuditChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// AuditActor identifies who made the audited change
+type AuditActor struct {
+	Session   claims.Session
+	RequestID string
+}
+
+type auditActorKey struct{}
+
+// WithAuditActor returns a context that attributes audited changes to actor.
+// Pass it to the query with db.WithContext.
+func WithAuditActor(ctx context.Context, actor AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+func auditActorFrom(ctx context.Context) AuditActor {
+	if ctx == nil {
+		return AuditActor{}
+	}
+	if actor, ok := ctx.Value(auditActorKey{}).(AuditActor); ok {
+		return actor
+	}
+	// a *gin.Context passed to WithContext exposes its keys as values
+	if session, ok := claims.SessionFrom(ctx); ok {
+		return AuditActor{Session: session, RequestID: requestid.FromContext(ctx)}
+	}
+	if auth, ok := claims.AuthFrom(ctx); ok {
+		return AuditActor{Session: claims.Session{TID: auth.TID, Type: auth.Type}, RequestID: requestid.FromContext(ctx)}
+	}
+	return AuditActor{}
+}
+
+// AuditPlugin records create, update and delete of Audited models into the
+// AuditLog table within the transaction of the change
+type AuditPlugin struct {
+	// ExcludedFields are column names never recorded for any model
+	ExcludedFields []string
+}
+
+func (p *AuditPlugin) Name() string {
+	return "hangover:audit"
+}
+
+func (p *AuditPlugin) Initialize(db *gorm.DB) error {
+	callbacks := []error{
+		db.Callback().Create().After("gorm:create").Register("audit:create", p.afterCreate),
+		db.Callback().Update().After("gorm:begin_transaction").Before("gorm:update").Register("audit:before_update", p.snapshot),
+		db.Callback().Update().After("gorm:update").Register("audit:update", p.afterUpdate),
+		db.Callback().Delete().After("gorm:begin_transaction").Before("gorm:delete").Register("audit:before_delete", p.snapshot),
+		db.Callback().Delete().After("gorm:delete").Register("audit:delete", p.afterDelete),
+	}
+	for _, err := range callbacks {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AuditHistory returns the audit entries of the entity of model with the given id, oldest first
+func AuditHistory(db *gorm.DB, model interface{}, id interface{}) ([]AuditLog, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	var history []AuditLog
+	err := db.Where("entity_table = ? AND entity_id = ?", stmt.Table, fmt.Sprint(id)).
+		Order("created_at, id").
+		Find(&history).Error
+	return history, err
+}
+
+func (p *AuditPlugin) enabled(db *gorm.DB) bool {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.Schema.PrioritizedPrimaryField == nil {
+		return false
+	}
+	_, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(auditable)
+	return ok
+}
+
+func (p *AuditPlugin) afterCreate(db *gorm.DB) {
+	if !p.enabled(db) || db.RowsAffected == 0 {
+		return
+	}
+	var entries []AuditLog
+	eachRow(db.Statement.ReflectValue, func(row reflect.Value) {
+		after := p.fieldValues(db, row)
+		entries = append(entries, p.entry(db, AuditCreate, entityID(db, row), nil, after))
+	})
+	p.write(db, entries)
+}
+
+// snapshot loads the rows about to change so the after callbacks can diff them
+func (p *AuditPlugin) snapshot(db *gorm.DB) {
+	if !p.enabled(db) {
+		return
+	}
+	rows, err := p.load(db, p.targetIDs(db))
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	db.InstanceSet(auditBeforeKey, rows)
+}
+
+func (p *AuditPlugin) afterUpdate(db *gorm.DB) {
+	before, ok := p.before(db)
+	if !ok {
+		return
+	}
+	ids := make([]string, 0, len(before))
+	for id := range before {
+		ids = append(ids, id)
+	}
+	after, err := p.load(db, ids)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	var entries []AuditLog
+	for id, old := range before {
+		entries = append(entries, p.entry(db, AuditUpdate, id, old, after[id]))
+	}
+	p.write(db, entries)
+}
+
+func (p *AuditPlugin) afterDelete(db *gorm.DB) {
+	before, ok := p.before(db)
+	if !ok {
+		return
+	}
+	var entries []AuditLog
+	for id, old := range before {
+		entries = append(entries, p.entry(db, AuditDelete, id, old, nil))
+	}
+	p.write(db, entries)
+}
+
+func (p *AuditPlugin) before(db *gorm.DB) (map[string]map[string]interface{}, bool) {
+	if !p.enabled(db) || db.RowsAffected == 0 {
+		return nil, false
+	}
+	value, ok := db.InstanceGet(auditBeforeKey)
+	if !ok {
+		return nil, false
+	}
+	before := value.(map[string]map[string]interface{})
+	return before, len(before) > 0
+}
+
+// targetIDs returns the primary keys set on the statement model, or nil when
+// the change is selected by its where conditions only
+func (p *AuditPlugin) targetIDs(db *gorm.DB) []string {
+	var ids []string
+	eachRow(db.Statement.ReflectValue, func(row reflect.Value) {
+		if _, zero := db.Statement.Schema.PrioritizedPrimaryField.ValueOf(db.Statement.Context, row); !zero {
+			ids = append(ids, entityID(db, row))
+		}
+	})
+	return ids
+}
+
+// load reads the current column values of the affected rows keyed by primary key
+func (p *AuditPlugin) load(db *gorm.DB, ids []string) (map[string]map[string]interface{}, error) {
+	primary := db.Statement.Schema.PrioritizedPrimaryField.DBName
+	query := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Table(db.Statement.Table)
+	if len(ids) > 0 {
+		query = query.Where(clause.IN{Column: clause.Column{Name: primary}, Values: toInterfaces(ids)})
+	} else if where, ok := db.Statement.Clauses["WHERE"].Expression.(clause.Where); ok {
+		query.Statement.AddClause(where)
+	} else {
+		return nil, nil
+	}
+
+	var rows []map[string]interface{}
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	loaded := make(map[string]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		id := fmt.Sprint(row[primary])
+		loaded[id] = p.exclude(db.Statement.Schema, row)
+	}
+	return loaded, nil
+}
+
+func (p *AuditPlugin) fieldValues(db *gorm.DB, row reflect.Value) map[string]interface{} {
+	values := map[string]interface{}{}
+	for _, field := range db.Statement.Schema.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		values[field.DBName], _ = field.ValueOf(db.Statement.Context, row)
+	}
+	return p.exclude(db.Statement.Schema, values)
+}
+
+func (p *AuditPlugin) exclude(s *schema.Schema, values map[string]interface{}) map[string]interface{} {
+	for _, name := range p.ExcludedFields {
+		delete(values, name)
+	}
+	for _, field := range s.Fields {
+		if field.Tag.Get("audit") == "-" {
+			delete(values, field.DBName)
+		}
+	}
+	return values
+}
+
+func (p *AuditPlugin) entry(db *gorm.DB, action, id string, before, after map[string]interface{}) AuditLog {
+	actor := auditActorFrom(db.Statement.Context)
+	return AuditLog{
+		Table:     db.Statement.Table,
+		EntityID:  id,
+		Action:    action,
+		Before:    marshalAudit(before),
+		After:     marshalAudit(after),
+		Diff:      marshalAudit(auditDiff(before, after)),
+		TenantID:  actor.Session.TID,
+		SessionID: actor.Session.SID,
+		RoleID:    actor.Session.RID,
+		RequestID: actor.RequestID,
+		CreatedAt: time.Now(),
+	}
+}
+
+// write stores entries on the connection of the change so they commit or roll back with it
+func (p *AuditPlugin) write(db *gorm.DB, entries []AuditLog) {
+	if len(entries) == 0 {
+		return
+	}
+	err := db.Session(&gorm.Session{NewDB: true, SkipHooks: true, SkipDefaultTransaction: true}).
+		Create(&entries).Error
+	if err != nil {
+		logger.Error("could not write audit log", zap.String("table", db.Statement.Table), zap.Error(err))
+		db.AddError(err)
+	}
+}
+
+func auditDiff(before, after map[string]interface{}) map[string]AuditChange {
+	diff := map[string]AuditChange{}
+	for key, value := range after {
+		if old, ok := before[key]; !ok || !sameJSON(old, value) {
+			diff[key] = AuditChange{Old: before[key], New: value}
+		}
+	}
+	for key, old := range before {
+		if _, ok := after[key]; !ok {
+			diff[key] = AuditChange{Old: old}
+		}
+	}
+	return diff
+}
+
+func sameJSON(a, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
+
+func marshalAudit(v interface{}) json.RawMessage {
+	if m, ok := v.(map[string]interface{}); ok && m == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func entityID(db *gorm.DB, row reflect.Value) string {
+	value, _ := db.Statement.Schema.PrioritizedPrimaryField.ValueOf(db.Statement.Context, row)
+	return fmt.Sprint(value)
+}
+
+func eachRow(value reflect.Value, fn func(row reflect.Value)) {
+	value = reflect.Indirect(value)
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			fn(reflect.Indirect(value.Index(i)))
+		}
+	case reflect.Struct:
+		fn(value)
+	}
+}
+
+func toInterfaces(values []string) []interface{} {
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
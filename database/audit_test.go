@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/robertantonyjaikumar/hangover-common/claims"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type auditTestAccount struct {
+	Audited
+	ID       uint `gorm:"primaryKey"`
+	Email    string
+	Balance  int
+	Password string `audit:"-"`
+}
+
+func openAuditTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(&AuditPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&auditTestAccount{}, &AuditLog{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestAuditPlugin(t *testing.T) {
+	db := openAuditTestDB(t)
+	ctx := WithAuditActor(context.Background(), AuditActor{
+		Session:   claims.Session{SID: "s1", TID: "acme", RID: "admin"},
+		RequestID: "req-1",
+	})
+	db = db.WithContext(ctx)
+
+	account := auditTestAccount{Email: "a@example.com", Balance: 10, Password: "hunter2"}
+	if err := db.Create(&account).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&account).Update("balance", 20).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where("email = ?", "a@example.com").Delete(&auditTestAccount{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := AuditHistory(db, &auditTestAccount{}, account.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		action string
+		diff   map[string]AuditChange
+	}{
+		{AuditCreate, map[string]AuditChange{
+			"id":      {New: float64(1)},
+			"email":   {New: "a@example.com"},
+			"balance": {New: float64(10)},
+		}},
+		{AuditUpdate, map[string]AuditChange{"balance": {Old: float64(10), New: float64(20)}}},
+		{AuditDelete, map[string]AuditChange{
+			"id":      {Old: float64(1)},
+			"email":   {Old: "a@example.com"},
+			"balance": {Old: float64(20)},
+		}},
+	}
+	if len(history) != len(tests) {
+		t.Fatalf("history has %d entries, want %d", len(history), len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			entry := history[i]
+			if entry.Action != tt.action {
+				t.Errorf("Action = %q, want %q", entry.Action, tt.action)
+			}
+			var diff map[string]AuditChange
+			if err := json.Unmarshal(entry.Diff, &diff); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(diff, tt.diff) {
+				t.Errorf("Diff = %v, want %v", diff, tt.diff)
+			}
+			if entry.TenantID != "acme" || entry.SessionID != "s1" || entry.RoleID != "admin" || entry.RequestID != "req-1" {
+				t.Errorf("actor = %s %s %s %s, want acme s1 admin req-1", entry.TenantID, entry.SessionID, entry.RoleID, entry.RequestID)
+			}
+		})
+	}
+}
+
+func TestAuditDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		before map[string]interface{}
+		after  map[string]interface{}
+		want   map[string]AuditChange
+	}{
+		{"unchanged", map[string]interface{}{"a": 1}, map[string]interface{}{"a": 1}, map[string]AuditChange{}},
+		{"changed", map[string]interface{}{"a": 1}, map[string]interface{}{"a": 2}, map[string]AuditChange{"a": {Old: 1, New: 2}}},
+		{"same JSON", map[string]interface{}{"a": int64(1)}, map[string]interface{}{"a": 1.0}, map[string]AuditChange{}},
+		{"added", nil, map[string]interface{}{"a": 1}, map[string]AuditChange{"a": {New: 1}}},
+		{"removed", map[string]interface{}{"a": 1}, nil, map[string]AuditChange{"a": {Old: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := auditDiff(tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("auditDiff = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
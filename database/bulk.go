@@ -0,0 +1,331 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/robertantonyjaikumar/hangover-common/telemetry"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// BulkOptions configures BulkInsert and BulkUpsert
+type BulkOptions struct {
+	// Columns restricts the copied columns, whose zero values are copied as
+	// is. Defaults to every creatable model field except auto increment
+	// primary keys. As with Create, zero fields get their default tag value,
+	// and fields defaulted by the database are left out when zero in every
+	// row. Set them in every row or in none.
+	Columns []string
+	// ConflictColumns is the ON CONFLICT target used by BulkUpsert. Defaults to
+	// the model primary keys.
+	ConflictColumns []string
+	// UpdateColumns are overwritten on conflict by BulkUpsert. Defaults to every
+	// copied column that is not a conflict column, a primary key or an
+	// autoCreateTime timestamp, as with GORM's UpdateAll. When there is nothing
+	// to update conflicting rows are left untouched.
+	UpdateColumns []string
+	// ProgressEvery is the number of rows between OnProgress calls
+	ProgressEvery int
+	// OnProgress is called with the number of rows copied so far
+	OnProgress func(copied int64)
+}
+
+// BulkInsert writes rows (a slice of GORM models) with the postgres COPY protocol
+func BulkInsert(ctx context.Context, db *gorm.DB, rows interface{}, opts BulkOptions) (copied int64, err error) {
+	ctx, finish := telemetry.StartSpan(ctx, "database.bulk_insert")
+	defer func() { finish(err) }()
+
+	plan, err := newBulkPlan(ctx, db, rows, opts)
+	if err != nil {
+		return 0, err
+	}
+	err = withPgxConn(ctx, db, func(conn *pgx.Conn) error {
+		copied, err = conn.CopyFrom(ctx, plan.table, plan.columns, plan.source(ctx))
+		return err
+	})
+	return copied, err
+}
+
+// BulkUpsert copies rows into a temporary table and merges them into the model
+// table with INSERT ... ON CONFLICT inside a single transaction. When several
+// rows share the conflict columns the last one wins.
+func BulkUpsert(ctx context.Context, db *gorm.DB, rows interface{}, opts BulkOptions) (merged int64, err error) {
+	ctx, finish := telemetry.StartSpan(ctx, "database.bulk_upsert")
+	defer func() { finish(err) }()
+
+	plan, err := newBulkPlan(ctx, db, rows, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	conflict := opts.ConflictColumns
+	if len(conflict) == 0 {
+		conflict = plan.schema.PrimaryFieldDBNames
+	}
+	if len(conflict) == 0 {
+		return 0, fmt.Errorf("database: bulk upsert into %s needs conflict columns", plan.schema.Table)
+	}
+	update := opts.UpdateColumns
+	if update == nil {
+		update = updateColumns(plan.fields, conflict)
+	}
+
+	temp := pgx.Identifier{"bulk_" + strings.ReplaceAll(plan.schema.Table, ".", "_")}
+	err = withPgxConn(ctx, db, func(conn *pgx.Conn) error {
+		return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, fmt.Sprintf(
+				"CREATE TEMP TABLE %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP",
+				temp.Sanitize(), plan.table.Sanitize(),
+			))
+			if err != nil {
+				return err
+			}
+			if _, err = tx.CopyFrom(ctx, temp, plan.columns, plan.source(ctx)); err != nil {
+				return err
+			}
+			tag, err := tx.Exec(ctx, mergeSQL(plan.table, temp, plan.columns, conflict, update))
+			merged = tag.RowsAffected()
+			return err
+		})
+	})
+	return merged, err
+}
+
+type bulkPlan struct {
+	schema  *schema.Schema
+	table   pgx.Identifier
+	columns []string
+	fields  []*schema.Field
+	rows    reflect.Value
+	opts    BulkOptions
+}
+
+func newBulkPlan(ctx context.Context, db *gorm.DB, rows interface{}, opts BulkOptions) (*bulkPlan, error) {
+	value := reflect.Indirect(reflect.ValueOf(rows))
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return nil, fmt.Errorf("database: bulk write expects a slice of models, got %T", rows)
+	}
+	// timestamps and defaults are set on the rows
+	if !value.CanAddr() && value.Kind() == reflect.Array {
+		return nil, fmt.Errorf("database: bulk write needs a slice or a pointer to the array, got %T", rows)
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(rows); err != nil {
+		return nil, err
+	}
+
+	plan := &bulkPlan{
+		schema: stmt.Schema,
+		table:  pgx.Identifier(strings.Split(stmt.Table, ".")),
+		rows:   value,
+		opts:   opts,
+	}
+	if len(opts.Columns) > 0 {
+		for _, column := range opts.Columns {
+			field := stmt.Schema.LookUpField(column)
+			if field == nil || field.DBName == "" {
+				return nil, fmt.Errorf("database: %s has no column %q", stmt.Schema.Name, column)
+			}
+			plan.fields = append(plan.fields, field)
+		}
+	} else {
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || !field.Creatable || field.AutoIncrement {
+				continue
+			}
+			if field.HasDefaultValue && field.DefaultValueInterface == nil {
+				set, err := setInRows(ctx, field, value)
+				if err != nil {
+					return nil, err
+				}
+				if !set {
+					continue
+				}
+			}
+			plan.fields = append(plan.fields, field)
+		}
+	}
+	for _, field := range plan.fields {
+		plan.columns = append(plan.columns, field.DBName)
+	}
+
+	// COPY bypasses the GORM create callbacks so fill in the timestamps and
+	// default values they would set
+	now := time.Now()
+	for i := 0; i < value.Len(); i++ {
+		row := reflect.Indirect(value.Index(i))
+		for _, field := range plan.fields {
+			var fill interface{}
+			switch {
+			case field.AutoCreateTime != 0 || field.AutoUpdateTime != 0:
+				fill = now
+			case len(opts.Columns) == 0 && field.DefaultValueInterface != nil:
+				fill = field.DefaultValueInterface
+			default:
+				continue
+			}
+			if _, zero := field.ValueOf(ctx, row); zero {
+				if err := field.Set(ctx, row, fill); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return plan, nil
+}
+
+// updateColumns returns the columns of fields overwritten on conflict by
+// default: neither conflict columns, primary keys nor creation timestamps
+func updateColumns(fields []*schema.Field, conflict []string) []string {
+	var update []string
+	for _, field := range fields {
+		if contains(conflict, field.DBName) || field.PrimaryKey || field.AutoCreateTime != 0 {
+			continue
+		}
+		update = append(update, field.DBName)
+	}
+	return update
+}
+
+// setInRows reports whether field, defaulted by the database, is set in the
+// rows. It fails when only some rows set it, as COPY can not leave a column
+// out of some rows only.
+func setInRows(ctx context.Context, field *schema.Field, rows reflect.Value) (bool, error) {
+	var set, unset int
+	for i := 0; i < rows.Len(); i++ {
+		if _, zero := field.ValueOf(ctx, reflect.Indirect(rows.Index(i))); zero {
+			unset++
+		} else {
+			set++
+		}
+	}
+	if set > 0 && unset > 0 {
+		return false, fmt.Errorf("database: %s is set in %d rows and left to its database default in %d, set it in every row or in none", field.DBName, set, unset)
+	}
+	return set > 0, nil
+}
+
+func (p *bulkPlan) source(ctx context.Context) pgx.CopyFromSource {
+	return &bulkSource{ctx: ctx, plan: p, index: -1}
+}
+
+// bulkSource feeds model rows to CopyFrom and reports progress
+type bulkSource struct {
+	ctx      context.Context
+	plan     *bulkPlan
+	index    int
+	reported int64
+	err      error
+}
+
+func (s *bulkSource) Next() bool {
+	if s.index >= 0 {
+		s.progress(int64(s.index+1), false)
+	}
+	s.index++
+	if err := s.ctx.Err(); err != nil {
+		s.err = err
+		return false
+	}
+	if s.index >= s.plan.rows.Len() {
+		s.progress(int64(s.plan.rows.Len()), true)
+		return false
+	}
+	return true
+}
+
+func (s *bulkSource) Values() ([]any, error) {
+	row := reflect.Indirect(s.plan.rows.Index(s.index))
+	values := make([]any, len(s.plan.fields))
+	for i, field := range s.plan.fields {
+		values[i], _ = field.ValueOf(s.ctx, row)
+	}
+	return values, nil
+}
+
+func (s *bulkSource) Err() error {
+	return s.err
+}
+
+func (s *bulkSource) progress(copied int64, done bool) {
+	if s.plan.opts.OnProgress == nil || copied == s.reported {
+		return
+	}
+	every := int64(s.plan.opts.ProgressEvery)
+	if !done && (every <= 0 || copied%every != 0) {
+		return
+	}
+	s.reported = copied
+	s.plan.opts.OnProgress(copied)
+}
+
+// withPgxConn runs fn on the pgx connection underneath db, unwrapping the
+// Datadog traced driver when present
+func withPgxConn(ctx context.Context, db *gorm.DB, fn func(conn *pgx.Conn) error) error {
+	sqlDb, err := db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDb.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		for {
+			switch c := driverConn.(type) {
+			case *stdlib.Conn:
+				return fn(c.Conn())
+			case interface{ WrappedConn() driver.Conn }:
+				driverConn = c.WrappedConn()
+			default:
+				return fmt.Errorf("database: bulk write needs a pgx connection, got %T", driverConn)
+			}
+		}
+	})
+}
+
+func mergeSQL(table, temp pgx.Identifier, columns, conflict, update []string) string {
+	cols := quoteColumns(columns)
+	target := quoteColumns(conflict)
+	// rows sharing the conflict columns would make the insert fail, keep the
+	// last one copied
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s) SELECT DISTINCT ON (%s) %s FROM %s ORDER BY %s, ctid DESC ON CONFLICT (%s)",
+		table.Sanitize(), cols, target, cols, temp.Sanitize(), target, target,
+	)
+	if len(update) == 0 {
+		return query + " DO NOTHING"
+	}
+	sets := make([]string, len(update))
+	for i, column := range update {
+		quoted := pgx.Identifier{column}.Sanitize()
+		sets[i] = quoted + " = EXCLUDED." + quoted
+	}
+	return query + " DO UPDATE SET " + strings.Join(sets, ", ")
+}
+
+func quoteColumns(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = pgx.Identifier{column}.Sanitize()
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
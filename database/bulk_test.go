@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm/schema"
+)
+
+func TestMergeSQL(t *testing.T) {
+	table := pgx.Identifier{"public", "users"}
+	temp := pgx.Identifier{"bulk_users"}
+	tests := []struct {
+		name     string
+		columns  []string
+		conflict []string
+		update   []string
+		want     string
+	}{
+		{
+			name:     "do nothing",
+			columns:  []string{"id", "email"},
+			conflict: []string{"id"},
+			want:     `INSERT INTO "public"."users" ("id", "email") SELECT DISTINCT ON ("id") "id", "email" FROM "bulk_users" ORDER BY "id", ctid DESC ON CONFLICT ("id") DO NOTHING`,
+		},
+		{
+			name:     "update",
+			columns:  []string{"id", "email", "name"},
+			conflict: []string{"id"},
+			update:   []string{"email", "name"},
+			want:     `INSERT INTO "public"."users" ("id", "email", "name") SELECT DISTINCT ON ("id") "id", "email", "name" FROM "bulk_users" ORDER BY "id", ctid DESC ON CONFLICT ("id") DO UPDATE SET "email" = EXCLUDED."email", "name" = EXCLUDED."name"`,
+		},
+		{
+			name:     "composite conflict",
+			columns:  []string{"tenant_id", "sku", "qty"},
+			conflict: []string{"tenant_id", "sku"},
+			update:   []string{"qty"},
+			want:     `INSERT INTO "public"."users" ("tenant_id", "sku", "qty") SELECT DISTINCT ON ("tenant_id", "sku") "tenant_id", "sku", "qty" FROM "bulk_users" ORDER BY "tenant_id", "sku", ctid DESC ON CONFLICT ("tenant_id", "sku") DO UPDATE SET "qty" = EXCLUDED."qty"`,
+		},
+		{
+			name:     "quoted identifiers",
+			columns:  []string{`we"ird`},
+			conflict: []string{`we"ird`},
+			want:     `INSERT INTO "public"."users" ("we""ird") SELECT DISTINCT ON ("we""ird") "we""ird" FROM "bulk_users" ORDER BY "we""ird", ctid DESC ON CONFLICT ("we""ird") DO NOTHING`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeSQL(table, temp, tt.columns, tt.conflict, tt.update); got != tt.want {
+				t.Errorf("mergeSQL() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+type bulkTestUser struct {
+	ID    string `gorm:"primaryKey;default:gen_random_uuid()"`
+	Email string
+}
+
+type bulkTestOrder struct {
+	TenantID  string `gorm:"primaryKey"`
+	Number    int    `gorm:"primaryKey"`
+	SKU       string `gorm:"uniqueIndex"`
+	Qty       int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func TestUpdateColumns(t *testing.T) {
+	s, err := schema.Parse(&bulkTestOrder{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		conflict []string
+		want     []string
+	}{
+		{name: "primary keys", conflict: []string{"tenant_id", "number"}, want: []string{"sku", "qty", "updated_at"}},
+		{name: "unique column", conflict: []string{"sku"}, want: []string{"qty", "updated_at"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := updateColumns(s.Fields, tt.conflict)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("updateColumns = %v, want %v", got, tt.want)
+			}
+			query := mergeSQL(pgx.Identifier{"orders"}, pgx.Identifier{"bulk_orders"}, s.DBNames, tt.conflict, got)
+			_, sets, _ := strings.Cut(query, "DO UPDATE SET ")
+			if strings.Contains(sets, "created_at") {
+				t.Errorf("DO UPDATE SET overwrites created_at: %s", sets)
+			}
+		})
+	}
+}
+
+func TestNewBulkPlanRejectsArrayValues(t *testing.T) {
+	if _, err := newBulkPlan(context.Background(), nil, [2]bulkTestUser{}, BulkOptions{}); err == nil {
+		t.Error("newBulkPlan accepted an array passed by value")
+	}
+}
+
+func TestSetInRows(t *testing.T) {
+	s, err := schema.Parse(&bulkTestUser{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := s.LookUpField("id")
+	tests := []struct {
+		name    string
+		rows    []bulkTestUser
+		want    bool
+		wantErr bool
+	}{
+		{name: "unset", rows: []bulkTestUser{{Email: "a"}, {Email: "b"}}, want: false},
+		{name: "set", rows: []bulkTestUser{{ID: "1"}, {ID: "2"}}, want: true},
+		{name: "mixed", rows: []bulkTestUser{{ID: "1"}, {Email: "b"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := setInRows(context.Background(), id, reflect.ValueOf(tt.rows))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setInRows error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("setInRows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,14 +1,14 @@
 package database
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 
-	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/robertantonyjaikumar/hangover-common/config"
 	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"github.com/robertantonyjaikumar/hangover-common/telemetry"
 	"go.uber.org/zap"
-	sqltrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql"
-	gormtrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/gorm.io/gorm.v1"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/plugin/dbresolver"
@@ -16,33 +16,75 @@ import (
 )
 
 var (
-	Db     = InitDb()
+	// Deprecated: use Default. Db is nil until Init or Default connects the
+	// default database.
+	Db     *gorm.DB
 	LOCAL  = "local"
 	HOSTED = "hosted"
 )
 
+// defaultDB is the database configured under database.*, connected by Init
+var defaultDB struct {
+	sync.Mutex
+	db *gorm.DB
+}
+
+// Init connects the database configured under database.* of config.Default()
+// unless it is already connected. Call it after config.Init. A failed
+// connection is retried by the next call.
+func Init() (*gorm.DB, error) {
+	defaultDB.Lock()
+	defer defaultDB.Unlock()
+	if defaultDB.db != nil {
+		return defaultDB.db, nil
+	}
+	db := InitDb()
+	if db == nil {
+		return nil, errors.New("database: could not connect the default database")
+	}
+	defaultDB.db = db
+	Db = db
+	return db, nil
+}
+
+// Default returns the default database, connecting it on first use. Returns
+// nil when the connection fails.
+func Default() *gorm.DB {
+	db, err := Init()
+	if err != nil {
+		logger.Error("Error connecting to database", zap.Error(err))
+	}
+	return db
+}
+
+// InitDb connects a new pool to the database configured under database.*,
+// prefer Init which connects it once
 func InitDb() *gorm.DB {
 	dbConfig := config.LoadDatabaseConfig()
-	if config.CFG.V.GetBool("database.single_source") {
+	if config.Default().Viper().GetBool("database.single_source") {
 		dbConfig = config.LoadDatabaseVaultConfig()
 	}
 
-	if config.CFG.V.GetString("env") == HOSTED {
-		return connectMultipleDB(dbConfig)
+	if config.Default().Viper().GetString("env") == HOSTED {
+		return connectMultipleDB(DefaultName, dbConfig)
 	}
-	return connectDB(dbConfig)
+	return connectDB(DefaultName, dbConfig)
 }
 
 // Returns an initialized *gorm.DB struct
-func connectDB(database *config.DBConfig) *gorm.DB {
+func connectDB(name string, database *config.DBConfig) *gorm.DB {
 
-	dsn := buildDSN(database.Driver, database.Creds.Username, database.Creds.Password, database.Hosts.Master, database.Port, database.DBName)
+	dsn := buildDSN(database, database.Hosts.Master)
 
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
 		logger.Error("Error connecting to database: connection url error", zap.Error(err))
 		return nil
 	}
+	if sqlDb, err := db.DB(); err == nil {
+		trackPool(name, roleMaster, sqlDb)
+	}
+	useRequestIDPlugin(db, database)
 	return db
 }
 
@@ -63,22 +105,18 @@ func RunMigrations(migrations Migrations) {
 	}
 }
 
-func connectMultipleDB(database *config.DBConfig) *gorm.DB {
+func connectMultipleDB(name string, database *config.DBConfig) *gorm.DB {
 	gormLogger := zapgorm2.New(logger.GetZapLogger())
 	gormLogger.SetAsDefault()
-	dsn := buildDSN(database.Driver, database.Creds.Username, database.Creds.Password, database.Hosts.Master, database.Port, database.DBName)
-	// Register augments the provided driver with tracing, enabling it to be loaded by
-	// gormtrace.Open.
-	sqltrace.Register(
-		"pgx",
-		&stdlib.Driver{},
-		sqltrace.WithServiceName(config.CFG.GetServiceName()),
-	)
-	sqlDb, err := sqltrace.Open("pgx", dsn)
+	dsn := buildDSN(database, database.Hosts.Master)
+	// the pools and gorm statements are traced by the telemetry backend
+	// selected by tracing.backend
+	sqlDb, err := telemetry.OpenDB(dsn)
 	if err != nil {
 		logger.Fatal("Error occurred", zap.Error(err))
 	}
-	db, err := gormtrace.Open(
+	trackPool(name, roleMaster, sqlDb)
+	db, err := gorm.Open(
 		postgres.New(postgres.Config{Conn: sqlDb}),
 		&gorm.Config{Logger: gormLogger},
 	)
@@ -86,10 +124,13 @@ func connectMultipleDB(database *config.DBConfig) *gorm.DB {
 		logger.Error("Error connecting to database: connection url error ", zap.Error(err))
 		return nil
 	}
+	if err := db.Use(telemetry.GormPlugin()); err != nil {
+		logger.Error("Error registering telemetry plugin", zap.Error(err))
+	}
 
 	//Create db sources(write instances) and replicas(read) from config
-	sources := createDialectors(database.Driver, database.Creds.Username, database.Creds.Password, database.Hosts.Sources, database.Port, database.DBName)
-	replicas := createDialectors(database.Driver, database.Creds.Username, database.Creds.Password, database.Hosts.Replicas, database.Port, database.DBName)
+	sources := createDialectors(name, roleSource, database, database.Hosts.Sources)
+	replicas := createDialectors(name, roleReplica, database, database.Hosts.Replicas)
 
 	//logger.Info("DB URLs", zap.Any("sources", sources), zap.Any("replicas", replicas))
 	err = db.Use(dbresolver.Register(dbresolver.Config{
@@ -102,19 +143,51 @@ func connectMultipleDB(database *config.DBConfig) *gorm.DB {
 		logger.Error("Error connecting to database ", zap.Error(err))
 		return nil
 	}
+	useRequestIDPlugin(db, database)
 
 	return db
 }
 
-func buildDSN(driver, username, password, host, port, dbName string) string {
-	return fmt.Sprintf("%s://%s:%s@%s:%s/%s?application_name=%s", driver, username, password, host, port, dbName, config.CFG.GetServiceName())
+// buildDSN returns the DSN of database on host. With request ID comments
+// statements are not prepared, as every SQL text is unique and would only
+// fill the statement cache.
+func buildDSN(database *config.DBConfig, host string) string {
+	dsn := fmt.Sprintf("%s://%s:%s@%s:%s/%s?application_name=%s", database.Driver, database.Creds.Username, database.Creds.Password, host, database.Port, database.DBName, config.Default().GetServiceName())
+	if database.RequestIDComments {
+		dsn += "&default_query_exec_mode=exec"
+	}
+	return dsn
 }
 
-func createDialectors(driver, username, password string, hosts []string, port, dbName string) []gorm.Dialector {
+// useRequestIDPlugin registers RequestIDPlugin on db when database enables it
+func useRequestIDPlugin(db *gorm.DB, database *config.DBConfig) {
+	if !database.RequestIDComments {
+		return
+	}
+	if err := db.Use(&RequestIDPlugin{}); err != nil {
+		logger.Error("Error registering request ID plugin", zap.Error(err))
+	}
+}
+
+// poolName labels the pool stats of a resolver host of the database
+// registered under name
+func poolName(name, host string) string {
+	return name + "@" + host
+}
+
+// createDialectors opens a traced pool per host of role so it can be closed on
+// shutdown
+func createDialectors(name, role string, database *config.DBConfig, hosts []string) []gorm.Dialector {
 	var dialectors []gorm.Dialector
 	for _, hosts := range hosts {
-		dsn := buildDSN(driver, username, password, hosts, port, dbName)
-		dialectors = append(dialectors, postgres.Open(dsn))
+		dsn := buildDSN(database, hosts)
+		sqlDb, err := telemetry.OpenDB(dsn)
+		if err != nil {
+			logger.Error("Error connecting to database host", zap.String("host", hosts), zap.Error(err))
+			continue
+		}
+		trackPool(poolName(name, hosts), role, sqlDb)
+		dialectors = append(dialectors, postgres.New(postgres.Config{Conn: sqlDb}))
 	}
 	return dialectors
 }
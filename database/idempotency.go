@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/robertantonyjaikumar/hangover-common/structs"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyKey is the table backing IdempotencyStore. Add it to the
+// migrations of any service that uses middlewares.IdempotencyMiddleware.
+type IdempotencyKey struct {
+	Scope       string `gorm:"primaryKey"`
+	Key         string `gorm:"primaryKey"`
+	Fingerprint string
+	Completed   bool
+	Status      int
+	ContentType string
+	Headers     http.Header `gorm:"serializer:json"`
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+}
+
+// IdempotencyStore implements middlewares.IdempotencyStore on postgres
+type IdempotencyStore struct {
+	DB *gorm.DB
+}
+
+func NewIdempotencyStore(db *gorm.DB) *IdempotencyStore {
+	return &IdempotencyStore{DB: db}
+}
+
+func (s *IdempotencyStore) Begin(ctx context.Context, scope, key, fingerprint string, ttl time.Duration) (*structs.IdempotencyRecord, error) {
+	db := s.DB.WithContext(ctx)
+	now := time.Now()
+	err := db.Where("scope = ? AND key = ? AND expires_at < ?", scope, key, now).
+		Delete(&IdempotencyKey{}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// the primary key makes concurrent duplicates lose the insert
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&IdempotencyKey{
+		Scope:       scope,
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	})
+	if result.Error != nil || result.RowsAffected == 1 {
+		return nil, result.Error
+	}
+
+	var existing IdempotencyKey
+	if err := db.Where("scope = ? AND key = ?", scope, key).Take(&existing).Error; err != nil {
+		return nil, err
+	}
+	return &structs.IdempotencyRecord{
+		Fingerprint: existing.Fingerprint,
+		Completed:   existing.Completed,
+		Status:      existing.Status,
+		ContentType: existing.ContentType,
+		Headers:     existing.Headers,
+		Body:        existing.Body,
+	}, nil
+}
+
+func (s *IdempotencyStore) Complete(ctx context.Context, scope, key string, record structs.IdempotencyRecord) error {
+	return s.DB.WithContext(ctx).Model(&IdempotencyKey{}).
+		Where("scope = ? AND key = ?", scope, key).
+		Select("completed", "status", "content_type", "headers", "body").
+		Updates(&IdempotencyKey{
+			Completed:   true,
+			Status:      record.Status,
+			ContentType: record.ContentType,
+			Headers:     record.Headers,
+			Body:        record.Body,
+		}).Error
+}
+
+func (s *IdempotencyStore) Release(ctx context.Context, scope, key string) error {
+	return s.DB.WithContext(ctx).Where("scope = ? AND key = ?", scope, key).
+		Delete(&IdempotencyKey{}).Error
+}
+
+// PurgeExpired deletes every expired key, run it periodically to keep the table small
+func (s *IdempotencyStore) PurgeExpired(ctx context.Context) (int64, error) {
+	result := s.DB.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robertantonyjaikumar/hangover-common/config"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// DefaultName is the registry name of Db, the database configured under database.*
+const DefaultName = "default"
+
+// ErrNotConfigured is returned by Lookup for a name neither registered nor
+// configured under databases.*
+var ErrNotConfigured = errors.New("database: not configured")
+
+// ConnectRetryInterval is how long Get returns nil for a database whose
+// connection failed before dialing it again
+var ConnectRetryInterval = 5 * time.Second
+
+// registry holds an entry per database name. Connecting locks the entry of
+// the name only, so a slow dial does not block the other databases.
+var registry = struct {
+	sync.Mutex
+	entries map[string]*registryEntry
+}{entries: map[string]*registryEntry{}}
+
+type registryEntry struct {
+	connect  sync.Mutex
+	db       atomic.Pointer[gorm.DB]
+	failedAt time.Time
+}
+
+// entry returns the entry of name, adding it when missing
+func entry(name string) *registryEntry {
+	registry.Lock()
+	defer registry.Unlock()
+	e, ok := registry.entries[name]
+	if !ok {
+		e = &registryEntry{}
+		registry.entries[name] = e
+	}
+	return e
+}
+
+// registered returns the entry of name when there is one
+func registered(name string) (*registryEntry, bool) {
+	registry.Lock()
+	defer registry.Unlock()
+	e, ok := registry.entries[name]
+	return e, ok
+}
+
+// Register adds db to the registry under name, replacing any previous entry
+func Register(name string, db *gorm.DB) {
+	entry(name).db.Store(db)
+}
+
+// Get returns the database registered under name, see Lookup. Returns nil
+// when Lookup fails.
+func Get(name string) *gorm.DB {
+	db, _ := Lookup(name)
+	return db
+}
+
+// Lookup returns the database registered under name. Databases configured
+// under databases.<name>.* are connected on first use. It returns
+// ErrNotConfigured for other names, and an error when the connection fails,
+// without dialing again for ConnectRetryInterval.
+func Lookup(name string) (*gorm.DB, error) {
+	if name == DefaultName {
+		return Init()
+	}
+	e, ok := registered(name)
+	if ok {
+		if db := e.db.Load(); db != nil {
+			return db, nil
+		}
+	}
+	if !config.DatabaseConfigured(name) {
+		return nil, fmt.Errorf("%w: %s", ErrNotConfigured, name)
+	}
+	if !ok {
+		e = entry(name)
+	}
+
+	e.connect.Lock()
+	defer e.connect.Unlock()
+	if db := e.db.Load(); db != nil {
+		return db, nil
+	}
+	if !e.failedAt.IsZero() && time.Since(e.failedAt) < ConnectRetryInterval {
+		return nil, fmt.Errorf("database %s: could not connect, retrying after %s", name, e.failedAt.Add(ConnectRetryInterval).Format(time.RFC3339))
+	}
+	db := OpenNamed(name)
+	if db == nil {
+		e.failedAt = time.Now()
+		return nil, fmt.Errorf("database %s: could not connect", name)
+	}
+	e.db.Store(db)
+	return db, nil
+}
+
+// OpenNamed connects to the database configured under databases.<name>.*,
+// using the resolver when sources or replicas are configured. Returns nil
+// when name is not configured or the connection fails.
+func OpenNamed(name string) *gorm.DB {
+	if !config.DatabaseConfigured(name) {
+		logger.Error("Error connecting to database: not configured", zap.String("name", name))
+		return nil
+	}
+	dbConfig := config.LoadNamedDatabaseConfig(name)
+	if len(dbConfig.Hosts.Sources) > 0 || len(dbConfig.Hosts.Replicas) > 0 {
+		return connectMultipleDB(name, dbConfig)
+	}
+	return connectDB(name, dbConfig)
+}
+
+// Names returns DefaultName, then the names of the databases configured under
+// databases.* or registered, connected or not
+func Names() []string {
+	seen := map[string]bool{DefaultName: true}
+	var names []string
+	for _, name := range config.DatabaseNames() {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	registry.Lock()
+	for name := range registry.entries {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	registry.Unlock()
+	sort.Strings(names)
+	return append([]string{DefaultName}, names...)
+}
+
+// ConnectAll connects every database configured under databases.*
+func ConnectAll() error {
+	var errs []error
+	for _, name := range config.DatabaseNames() {
+		if _, err := Lookup(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// HealthCheck pings every database of Names, connecting those not connected
+// yet, and returns the failures by name
+func HealthCheck(ctx context.Context) map[string]error {
+	failures := map[string]error{}
+	for _, name := range Names() {
+		db, err := Lookup(name)
+		if err == nil {
+			err = ping(ctx, db)
+		}
+		if err != nil {
+			failures[name] = err
+		}
+	}
+	return failures
+}
+
+func ping(ctx context.Context, db *gorm.DB) error {
+	sqlDb, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDb.PingContext(ctx)
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/robertantonyjaikumar/hangover-common/config"
+	"github.com/spf13/viper"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// useRegistryTestConfig makes v the default config and empties the registry
+// for the duration of the test
+func useRegistryTestConfig(t *testing.T, v *viper.Viper) {
+	t.Helper()
+	previous := config.CFG
+	config.SetDefault(&config.Configuration{V: v})
+	t.Cleanup(func() {
+		config.SetDefault(previous)
+		registry.Lock()
+		registry.entries = map[string]*registryEntry{}
+		registry.Unlock()
+	})
+}
+
+func TestLookup(t *testing.T) {
+	v := viper.New()
+	v.Set("databases.reports", map[string]interface{}{
+		"driver": "postgres",
+		"hosts":  map[string]interface{}{"master": "127.0.0.1"},
+		"port":   "1",
+		"dbname": "reports",
+		"creds":  map[string]interface{}{"source": "config", "username": "u", "password": "p"},
+	})
+	useRegistryTestConfig(t, v)
+
+	cache, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Register("cache", cache)
+
+	tests := []struct {
+		name    string
+		db      string
+		want    *gorm.DB
+		wantErr string
+	}{
+		{name: "registered", db: "cache", want: cache},
+		{name: "not configured", db: "missing", wantErr: "database: not configured: missing"},
+		{name: "connection failure", db: "reports", wantErr: "database reports: could not connect"},
+		{name: "retry backoff", db: "reports", wantErr: "database reports: could not connect, retrying after"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := Lookup(tt.db)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)) {
+				t.Fatalf("Lookup error = %v, want %q", err, tt.wantErr)
+			}
+			if db != tt.want {
+				t.Errorf("Lookup = %p, want %p", db, tt.want)
+			}
+		})
+	}
+
+	if _, err := Lookup("missing"); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Lookup error = %v, want ErrNotConfigured", err)
+	}
+	if got, want := Names(), []string{DefaultName, "cache", "reports"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/robertantonyjaikumar/hangover-common/requestid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// requestIDComment starts the SQL comment of a statement run for a request
+const requestIDComment = "/* request_id="
+
+// RequestIDPlugin prefixes the SQL of every statement run with a context
+// carrying a request ID, see requestid.WithContext, with a comment such as
+// /* request_id='0b5c...' */ so it shows in pg_stat_activity and slow query
+// logs. Pass the request context with db.WithContext. Every connection also
+// sets application_name to the service name.
+//
+// As every statement text is unique, the pgx statement cache would only grow,
+// so the plugin is opt-in with database.request_id_comments (or
+// databases.<name>.request_id_comments), which also connects with
+// default_query_exec_mode=exec. Registering it by hand needs that mode, or
+// simple_protocol, in the DSN too.
+type RequestIDPlugin struct{}
+
+func (p *RequestIDPlugin) Name() string {
+	return "hangover:request_id"
+}
+
+func (p *RequestIDPlugin) Initialize(db *gorm.DB) error {
+	callbacks := []error{
+		db.Callback().Create().Before("gorm:create").Register("request_id:create", commentWith("INSERT")),
+		db.Callback().Query().Before("gorm:query").Register("request_id:query", commentWith("SELECT")),
+		db.Callback().Update().Before("gorm:update").Register("request_id:update", commentWith("UPDATE")),
+		db.Callback().Delete().Before("gorm:delete").Register("request_id:delete", commentWith("DELETE")),
+		db.Callback().Row().Before("gorm:row").Register("request_id:row", commentWith("SELECT")),
+		db.Callback().Raw().Before("gorm:raw").Register("request_id:raw", commentWith("")),
+	}
+	for _, err := range callbacks {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commentWith returns a callback adding the comment before the clause name,
+// or before the SQL of raw statements
+func commentWith(name string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error != nil || db.Statement.Context == nil {
+			return
+		}
+		id := requestid.FromContext(db.Statement.Context)
+		if !requestid.Valid(id) {
+			return
+		}
+		comment := requestIDComment + "'" + id + "' */"
+
+		if db.Statement.SQL.Len() > 0 || name == "" {
+			sql := db.Statement.SQL.String()
+			if strings.HasPrefix(sql, requestIDComment) {
+				return
+			}
+			db.Statement.SQL.Reset()
+			db.Statement.SQL.WriteString(comment + " " + sql)
+			return
+		}
+		c := db.Statement.Clauses[name]
+		c.BeforeExpression = clause.Expr{SQL: comment}
+		db.Statement.Clauses[name] = c
+	}
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/robertantonyjaikumar/hangover-common/requestid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type requestIDTestItem struct {
+	ID   uint
+	Name string
+}
+
+func TestRequestIDPlugin(t *testing.T) {
+	// statements are only built, nothing connects
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1"}), &gorm.Config{
+		Logger:                 gormlogger.Discard,
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(&RequestIDPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	const comment = "/* request_id='req-1' */ "
+	withID := requestid.WithContext(context.Background(), "req-1")
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		run  func(tx *gorm.DB) *gorm.DB
+		want string
+	}{
+		{"create", withID, func(tx *gorm.DB) *gorm.DB { return tx.Create(&requestIDTestItem{Name: "a"}) }, comment + "INSERT"},
+		{"query", withID, func(tx *gorm.DB) *gorm.DB { return tx.Find(&[]requestIDTestItem{}) }, comment + "SELECT"},
+		{"update", withID, func(tx *gorm.DB) *gorm.DB {
+			return tx.Model(&requestIDTestItem{ID: 1}).Update("name", "b")
+		}, comment + "UPDATE"},
+		{"delete", withID, func(tx *gorm.DB) *gorm.DB { return tx.Delete(&requestIDTestItem{ID: 1}) }, comment + "DELETE"},
+		{"raw", withID, func(tx *gorm.DB) *gorm.DB { return tx.Exec("DELETE FROM request_id_test_items") }, comment + "DELETE"},
+		{"no request id", context.Background(), func(tx *gorm.DB) *gorm.DB { return tx.Find(&[]requestIDTestItem{}) }, "SELECT"},
+		{"invalid request id", requestid.WithContext(context.Background(), "x' */ DROP"), func(tx *gorm.DB) *gorm.DB {
+			return tx.Find(&[]requestIDTestItem{})
+		}, "SELECT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.run(db.WithContext(tt.ctx))
+			if result.Error != nil {
+				t.Fatal(result.Error)
+			}
+			if sql := result.Statement.SQL.String(); !strings.HasPrefix(sql, tt.want) {
+				t.Errorf("SQL = %q, want prefix %q", sql, tt.want)
+			}
+		})
+	}
+}
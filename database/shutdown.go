@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/robertantonyjaikumar/hangover-common/config"
+	"github.com/robertantonyjaikumar/hangover-common/lifecycle"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"github.com/robertantonyjaikumar/hangover-common/metrics"
+	"github.com/robertantonyjaikumar/hangover-common/telemetry"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// flushTimeout bounds flushing pending traces once the pools are closed
+const flushTimeout = 5 * time.Second
+
+// pools holds every connection pool opened by this package, including the
+// resolver sources and replicas that gorm does not expose
+var pools = struct {
+	sync.Mutex
+	all []*sql.DB
+}{}
+
+// Roles of the pools of a database in their metrics
+const (
+	roleMaster  = "master"
+	roleSource  = "source"
+	roleReplica = "replica"
+)
+
+// trackPool records sqlDb for Close and exports its stats as db_name=name, the
+// registry name of its database or name@host for resolver hosts, and
+// db_role=role
+func trackPool(name, role string, sqlDb *sql.DB) {
+	pools.Lock()
+	defer pools.Unlock()
+	pools.all = append(pools.all, sqlDb)
+	metrics.RegisterDB(name, role, sqlDb)
+}
+
+// Close stops the database credentials watcher, waits for in-flight queries
+// and closes every pool opened so far, then flushes pending traces within
+// flushTimeout. Databases never connected have no pool and are not dialed.
+// The default database and the registry are emptied, Default and Get connect
+// again. It returns ctx.Err() when the pools are not drained before ctx is
+// done.
+func Close(ctx context.Context) error {
+	config.StopWatching()
+
+	pools.Lock()
+	closing := pools.all
+	pools.all = nil
+	pools.Unlock()
+	for _, db := range disconnect() {
+		if sqlDb, err := db.DB(); err == nil && !containsPool(closing, sqlDb) {
+			closing = append(closing, sqlDb)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		var wg sync.WaitGroup
+		errs := make([]error, len(closing))
+		for i, sqlDb := range closing {
+			wg.Add(1)
+			go func(i int, sqlDb *sql.DB) {
+				defer wg.Done()
+				// sql.DB.Close waits for the queries already running
+				errs[i] = sqlDb.Close()
+			}(i, sqlDb)
+		}
+		wg.Wait()
+		done <- errors.Join(errs...)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		logger.Error("database pools not drained before the deadline", zap.Error(err))
+	}
+	flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), flushTimeout)
+	defer cancel()
+	if ferr := telemetry.Flush(flushCtx); ferr != nil {
+		logger.Error("could not flush traces", zap.Error(ferr))
+	}
+	return err
+}
+
+// disconnect empties the default database and the registry and returns the
+// databases they held
+func disconnect() []*gorm.DB {
+	var dbs []*gorm.DB
+	defaultDB.Lock()
+	if defaultDB.db != nil {
+		dbs = append(dbs, defaultDB.db)
+	}
+	defaultDB.db = nil
+	Db = nil
+	defaultDB.Unlock()
+
+	registry.Lock()
+	defer registry.Unlock()
+	for _, e := range registry.entries {
+		if db := e.db.Load(); db != nil {
+			dbs = append(dbs, db)
+		}
+	}
+	registry.entries = map[string]*registryEntry{}
+	return dbs
+}
+
+// CloseAll closes the connection pools of every registered database
+func CloseAll() error {
+	return Close(context.Background())
+}
+
+// Hook returns the lifecycle hook that health checks every registered
+// database on start and closes them on stop
+func Hook() lifecycle.Hook {
+	return lifecycle.Hook{
+		Name: "database",
+		OnStart: func(ctx context.Context) error {
+			var errs []error
+			for name, err := range HealthCheck(ctx) {
+				errs = append(errs, errors.New("database "+name+": "+err.Error()))
+			}
+			return errors.Join(errs...)
+		},
+		OnStop: Close,
+	}
+}
+
+func containsPool(all []*sql.DB, sqlDb *sql.DB) bool {
+	for _, p := range all {
+		if p == sqlDb {
+			return true
+		}
+	}
+	return false
+}
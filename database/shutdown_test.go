@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/viper"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestClose(t *testing.T) {
+	useRegistryTestConfig(t, viper.New())
+	open := func() *gorm.DB {
+		db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Discard})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+	main, cache := open(), open()
+	defaultDB.Lock()
+	defaultDB.db, Db = main, main
+	defaultDB.Unlock()
+	Register("cache", cache)
+
+	if err := Close(context.Background()); err != nil {
+		t.Fatalf("Close = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		db   *gorm.DB
+	}{
+		{"default", main},
+		{"registered", cache},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDb, err := tt.db.DB()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sqlDb.Ping(); err == nil {
+				t.Error("pool still open after Close")
+			}
+		})
+	}
+	defaultDB.Lock()
+	if defaultDB.db != nil || Db != nil {
+		t.Error("default database kept after Close")
+	}
+	defaultDB.Unlock()
+	if _, err := Lookup("cache"); err == nil {
+		t.Error("Lookup returned a closed database")
+	}
+	if names := Names(); len(names) != 1 {
+		t.Errorf("Names = %v, want only the default", names)
+	}
+}
@@ -0,0 +1,197 @@
+package flags
+
+import (
+	"errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robertantonyjaikumar/hangover-common/claims"
+	"github.com/robertantonyjaikumar/hangover-common/config"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Flag is a feature flag read from flags.<name>:
+//
+//	flags:
+//	  new_checkout:
+//	    enabled: true
+//	    percentage: 25
+//	    tenants: [acme]
+//	    roles: [admin]
+//	    exclude_tenants: [globex]
+//
+// A disabled flag is off. Excluded tenants are off, listed tenants and roles
+// are on, everyone else is on for percentage of tenants. Tenants and roles
+// are an allow-list: when either is set percentage defaults to 0, so only
+// they get the flag, else it defaults to 100.
+type Flag struct {
+	Enabled        bool     `config:"enabled" desc:"master switch of the flag"`
+	Percentage     float64  `config:"percentage" validate:"min=0,max=100" desc:"share of other tenants the flag is rolled out to, 0 when tenants or roles are set else 100 by default"`
+	Tenants        []string `config:"tenants" desc:"tenants the flag is always on for"`
+	Roles          []string `config:"roles" desc:"roles the flag is always on for"`
+	ExcludeTenants []string `config:"exclude_tenants" desc:"tenants the flag is always off for"`
+}
+
+// Subject is who a flag is evaluated for
+type Subject struct {
+	TenantID  string
+	RoleID    string
+	SessionID string
+}
+
+var (
+	current atomic.Pointer[map[string]Flag]
+	loaded  struct {
+		sync.Mutex
+		cfg *config.Configuration
+	}
+)
+
+// Load reads the flag definitions from cfg and reloads them whenever the
+// flags tree changes, even when this first read fails. It runs on the first
+// evaluation when not called before. Calling it again with the same cfg
+// retries a failed read, with another cfg returns an error.
+func Load(cfg *config.Configuration) error {
+	loaded.Lock()
+	defer loaded.Unlock()
+	switch loaded.cfg {
+	case cfg:
+		if current.Load() != nil {
+			return nil
+		}
+	case nil:
+		loaded.cfg = cfg
+		cfg.AddValidator(func(v *viper.Viper) error {
+			_, err := read(v)
+			return err
+		})
+		cfg.Watch("flags", func(_, _ interface{}) {
+			defs, err := read(cfg.Viper())
+			if err != nil {
+				logger.Error("could not reload feature flags", zap.Error(err))
+				return
+			}
+			current.Store(&defs)
+			logger.Info("feature flags reloaded", zap.Int("flags", len(defs)))
+		})
+	default:
+		return errors.New("flags: already loaded from another configuration")
+	}
+	defs, err := read(cfg.Viper())
+	if err != nil {
+		return err
+	}
+	current.Store(&defs)
+	return nil
+}
+
+func read(v *viper.Viper) (map[string]Flag, error) {
+	defs := map[string]Flag{}
+	for name := range v.GetStringMap("flags") {
+		prefix := "flags." + name
+		flag, err := config.Load[Flag](config.LoadOptions{Prefix: prefix, Viper: v})
+		if err != nil {
+			return nil, err
+		}
+		if !v.IsSet(prefix + ".percentage") {
+			flag.Percentage = defaultPercentage(flag)
+		}
+		defs[name] = flag
+	}
+	return defs, nil
+}
+
+// defaultPercentage rolls a flag out to nobody beyond its targets, or to
+// everyone when it has none
+func defaultPercentage(f Flag) float64 {
+	if len(f.Tenants) > 0 || len(f.Roles) > 0 {
+		return 0
+	}
+	return 100
+}
+
+// Evaluate reports whether flag name is on for subject. Unknown flags are off.
+func Evaluate(name string, subject Subject) bool {
+	if current.Load() == nil {
+		if err := Load(config.Default()); err != nil {
+			logger.Error("could not load feature flags", zap.Error(err))
+		}
+	}
+	var defs map[string]Flag
+	if loaded := current.Load(); loaded != nil {
+		defs = *loaded
+	}
+
+	flag, ok := defs[name]
+	on, reason := false, "unknown"
+	if ok {
+		on, reason = flag.evaluate(name, subject)
+	}
+	logger.Debug(
+		"feature flag evaluated",
+		zap.String("flag", name),
+		zap.String("tenant_id", subject.TenantID),
+		zap.String("role_id", subject.RoleID),
+		zap.Bool("enabled", on),
+		zap.String("reason", reason),
+	)
+	return on
+}
+
+// Enabled reports whether flag name is on for the tenant and role of the
+// authenticated request
+func Enabled(c *gin.Context, name string) bool {
+	return Evaluate(name, subjectFrom(c))
+}
+
+func subjectFrom(c *gin.Context) Subject {
+	if session, ok := claims.SessionFrom(c); ok {
+		return Subject{TenantID: session.TID, RoleID: session.RID, SessionID: session.SID}
+	}
+	if auth, ok := claims.AuthFrom(c); ok {
+		return Subject{TenantID: auth.TID}
+	}
+	return Subject{}
+}
+
+func (f Flag) evaluate(name string, subject Subject) (bool, string) {
+	switch {
+	case !f.Enabled:
+		return false, "disabled"
+	case subject.TenantID != "" && contains(f.ExcludeTenants, subject.TenantID):
+		return false, "excluded tenant"
+	case subject.TenantID != "" && contains(f.Tenants, subject.TenantID):
+		return true, "tenant"
+	case subject.RoleID != "" && contains(f.Roles, subject.RoleID):
+		return true, "role"
+	case f.Percentage >= 100:
+		return true, "enabled"
+	case f.Percentage <= 0:
+		return false, "not targeted"
+	}
+	key := subject.TenantID
+	if key == "" {
+		key = subject.SessionID
+	}
+	return bucket(name, key) < f.Percentage, "percentage"
+}
+
+// bucket places key in [0, 100) consistently for a flag
+func bucket(name, key string) float64 {
+	hash := fnv.New32a()
+	hash.Write([]byte(name + ":" + key))
+	return float64(hash.Sum32()%10000) / 100
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
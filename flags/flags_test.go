@@ -0,0 +1,103 @@
+package flags
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestEvaluate(t *testing.T) {
+	v := viper.New()
+	v.Set("flags", map[string]interface{}{
+		"off":      map[string]interface{}{"enabled": false, "tenants": []string{"acme"}},
+		"all":      map[string]interface{}{"enabled": true},
+		"targeted": map[string]interface{}{"enabled": true, "tenants": []string{"acme"}, "roles": []string{"admin"}},
+		"rollout": map[string]interface{}{
+			"enabled":         true,
+			"percentage":      50,
+			"tenants":         []string{"acme"},
+			"exclude_tenants": []string{"globex"},
+		},
+		"none": map[string]interface{}{"enabled": true, "percentage": 0},
+	})
+	defs, err := read(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tenants hashed below and above 50 for the rollout flag
+	var in, out string
+	for _, tenant := range []string{"t1", "t2", "t3", "t4", "t5", "t6", "t7", "t8"} {
+		if bucket("rollout", tenant) < 50 {
+			in = tenant
+		} else {
+			out = tenant
+		}
+	}
+	if in == "" || out == "" {
+		t.Fatal("no tenants on both sides of the rollout")
+	}
+
+	tests := []struct {
+		flag       string
+		subject    Subject
+		want       bool
+		wantReason string
+	}{
+		{"missing", Subject{TenantID: "acme"}, false, "unknown"},
+		{"off", Subject{TenantID: "acme"}, false, "disabled"},
+		{"all", Subject{TenantID: "anyone"}, true, "enabled"},
+		{"targeted", Subject{TenantID: "acme"}, true, "tenant"},
+		{"targeted", Subject{TenantID: "other", RoleID: "admin"}, true, "role"},
+		{"targeted", Subject{TenantID: "other", RoleID: "user"}, false, "not targeted"},
+		{"rollout", Subject{TenantID: "globex"}, false, "excluded tenant"},
+		{"rollout", Subject{TenantID: "acme"}, true, "tenant"},
+		{"rollout", Subject{TenantID: in}, true, "percentage"},
+		{"rollout", Subject{TenantID: out}, false, "percentage"},
+		{"none", Subject{TenantID: "acme"}, false, "not targeted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.flag+"/"+tt.subject.TenantID+"/"+tt.subject.RoleID, func(t *testing.T) {
+			flag, ok := defs[tt.flag]
+			on, reason := false, "unknown"
+			if ok {
+				on, reason = flag.evaluate(tt.flag, tt.subject)
+			}
+			if on != tt.want || reason != tt.wantReason {
+				t.Errorf("evaluate = %v %q, want %v %q", on, reason, tt.want, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestDefaultPercentage(t *testing.T) {
+	tests := []struct {
+		name string
+		flag Flag
+		want float64
+	}{
+		{"no targets", Flag{}, 100},
+		{"tenants", Flag{Tenants: []string{"acme"}}, 0},
+		{"roles", Flag{Roles: []string{"admin"}}, 0},
+		{"excluded tenants only", Flag{ExcludeTenants: []string{"globex"}}, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := defaultPercentage(tt.flag); got != tt.want {
+				t.Errorf("defaultPercentage = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBucketIsStable(t *testing.T) {
+	first := bucket("flag", "acme")
+	for i := 0; i < 10; i++ {
+		if got := bucket("flag", "acme"); got != first {
+			t.Fatalf("bucket = %v, then %v", first, got)
+		}
+	}
+	if first < 0 || first >= 100 {
+		t.Errorf("bucket = %v, want [0, 100)", first)
+	}
+}
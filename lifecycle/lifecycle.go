@@ -0,0 +1,98 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"go.uber.org/zap"
+)
+
+// Hook is a component started and stopped by the Manager. Either func may be nil.
+type Hook struct {
+	Name    string
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+// Manager starts hooks in the order they were appended and stops them in reverse
+type Manager struct {
+	mu      sync.Mutex
+	hooks   []Hook
+	started int
+}
+
+func New() *Manager {
+	return &Manager{}
+}
+
+// Append adds hooks after the ones already registered
+func (m *Manager) Append(hooks ...Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hooks...)
+}
+
+// Start runs every OnStart in order. When one fails the hooks already started
+// are stopped and the error is returned.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for m.started < len(m.hooks) {
+		hook := m.hooks[m.started]
+		if hook.OnStart != nil {
+			logger.Info("starting", zap.String("hook", hook.Name))
+			if err := hook.OnStart(ctx); err != nil {
+				startErr := fmt.Errorf("start %s: %w", hook.Name, err)
+				return errors.Join(startErr, m.stop(ctx))
+			}
+		}
+		m.started++
+	}
+	return nil
+}
+
+// Stop runs OnStop of every started hook in reverse order, continuing past
+// failures, and returns every error
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stop(ctx)
+}
+
+func (m *Manager) stop(ctx context.Context) error {
+	var errs []error
+	for ; m.started > 0; m.started-- {
+		hook := m.hooks[m.started-1]
+		if hook.OnStop == nil {
+			continue
+		}
+		logger.Info("stopping", zap.String("hook", hook.Name))
+		if err := hook.OnStop(ctx); err != nil {
+			logger.Error("stop failed", zap.String("hook", hook.Name), zap.Error(err))
+			errs = append(errs, fmt.Errorf("stop %s: %w", hook.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run starts the hooks, waits for ctx to be done or for SIGINT or SIGTERM,
+// then stops them within stopTimeout
+func (m *Manager) Run(ctx context.Context, stopTimeout time.Duration) error {
+	if err := m.Start(ctx); err != nil {
+		return err
+	}
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	cancel()
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer stopCancel()
+	return m.Stop(stopCtx)
+}
@@ -0,0 +1,111 @@
+package logger
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// GinKey is the gin context key the request scoped logger is also stored
+// under, so FromContext finds it on a *gin.Context whose engine does not fall
+// back to the request context
+const GinKey = "x-logger"
+
+type ctxKey struct{}
+
+var (
+	hooksMu sync.RWMutex
+	hooks   []func(ctx context.Context) []zap.Field
+)
+
+// AddContextFields registers fn, whose fields are added to the loggers
+// returned by FromContext and used by the *WithSessionCtx functions. It is
+// called on every lookup, for values that change within a request such as
+// the active trace span.
+func AddContextFields(fn func(ctx context.Context) []zap.Field) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, fn)
+}
+
+// ContextFields returns the fields of the functions registered with
+// AddContextFields for ctx. A *gin.Context is read through its request context.
+func ContextFields(ctx context.Context) []zap.Field {
+	if c, ok := ctx.(*gin.Context); ok && c != nil && c.Request != nil {
+		ctx = c.Request.Context()
+	}
+	if ctx == nil {
+		return nil
+	}
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	var fields []zap.Field
+	for _, fn := range hooks {
+		fields = append(fields, fn(ctx)...)
+	}
+	return fields
+}
+
+// WithContext returns a copy of ctx carrying the logger of ctx with fields added
+func WithContext(ctx context.Context, fields ...zap.Field) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	l, ok := stored(ctx)
+	if !ok {
+		l = get().WithOptions(zap.AddCallerSkip(-1))
+	}
+	return context.WithValue(ctx, ctxKey{}, l.With(fields...))
+}
+
+// WithGinContext adds fields to the request scoped logger of c, carried by
+// both its request context and its keys
+func WithGinContext(c *gin.Context, fields ...zap.Field) {
+	ctx := WithContext(c.Request.Context(), fields...)
+	c.Request = c.Request.WithContext(ctx)
+	c.Set(GinKey, ctx.Value(ctxKey{}))
+}
+
+// FromContext returns the request scoped logger carried by ctx, or the
+// default logger when there is none
+func FromContext(ctx context.Context) *zap.Logger {
+	l, ok := stored(ctx)
+	if !ok {
+		l = get().WithOptions(zap.AddCallerSkip(-1))
+	}
+	if fields := ContextFields(ctx); len(fields) > 0 {
+		l = l.With(fields...)
+	}
+	return l
+}
+
+// fromContext returns the logger of ctx for the package level functions,
+// and whether ctx carries one
+func fromContext(ctx context.Context) (*zap.Logger, bool) {
+	l, ok := stored(ctx)
+	if ok {
+		l = l.WithOptions(zap.AddCallerSkip(1))
+	} else {
+		l = get()
+	}
+	if fields := ContextFields(ctx); len(fields) > 0 {
+		l = l.With(fields...)
+	}
+	return l, ok
+}
+
+// stored returns the logger put on ctx by WithContext
+func stored(ctx context.Context) (*zap.Logger, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	if l, ok := ctx.Value(ctxKey{}).(*zap.Logger); ok {
+		return l, true
+	}
+	if l, ok := ctx.Value(GinKey).(*zap.Logger); ok {
+		return l, true
+	}
+	return nil, false
+}
@@ -0,0 +1,101 @@
+package logger
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type testTraceKey struct{}
+
+// useObservedDefault makes an observed logger the default one for the test
+func useObservedDefault(t *testing.T) *observer.ObservedLogs {
+	core, logs := observer.New(zapcore.DebugLevel)
+	previous := zapLog.Load()
+	t.Cleanup(func() { zapLog.Store(previous) })
+	SetDefault(zap.New(core))
+	return logs
+}
+
+func TestContextLogger(t *testing.T) {
+	logs := useObservedDefault(t)
+	hooksMu.Lock()
+	previous := hooks
+	hooksMu.Unlock()
+	t.Cleanup(func() {
+		hooksMu.Lock()
+		hooks = previous
+		hooksMu.Unlock()
+	})
+	AddContextFields(func(ctx context.Context) []zap.Field {
+		if id, ok := ctx.Value(testTraceKey{}).(string); ok {
+			return []zap.Field{zap.String("trace_id", id)}
+		}
+		return nil
+	})
+
+	request := WithContext(context.Background(), zap.String("request_id", "r1"))
+	request = WithContext(request, zap.String("tenant_id", "acme"))
+	traced := context.WithValue(request, testTraceKey{}, "t1")
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	WithGinContext(c, zap.String("request_id", "r2"))
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), testTraceKey{}, "t2"))
+
+	tests := []struct {
+		name string
+		log  func()
+		want map[string]interface{}
+	}{
+		{
+			name: "no request logger",
+			log:  func() { FromContext(context.Background()).Info("msg") },
+			want: map[string]interface{}{},
+		},
+		{
+			name: "fields added in turn",
+			log:  func() { FromContext(request).Info("msg") },
+			want: map[string]interface{}{"request_id": "r1", "tenant_id": "acme"},
+		},
+		{
+			name: "context fields",
+			log:  func() { FromContext(traced).Info("msg") },
+			want: map[string]interface{}{"request_id": "r1", "tenant_id": "acme", "trace_id": "t1"},
+		},
+		{
+			name: "gin context",
+			log:  func() { FromContext(c).Info("msg") },
+			want: map[string]interface{}{"request_id": "r2", "trace_id": "t2"},
+		},
+		{
+			name: "session functions",
+			log:  func() { InfoWithSessionCtx(c, "msg", zap.String("extra", "x")) },
+			want: map[string]interface{}{"request_id": "r2", "trace_id": "t2", "extra": "x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.log()
+			entries := logs.TakeAll()
+			if len(entries) != 1 {
+				t.Fatalf("logged %d entries, want 1", len(entries))
+			}
+			got := entries[0].ContextMap()
+			if len(got) != len(tt.want) {
+				t.Errorf("fields = %v, want %v", got, tt.want)
+			}
+			for key, value := range tt.want {
+				if got[key] != value {
+					t.Errorf("%s = %v, want %v", key, got[key], value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package logger
+
+import (
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+var droppedEntries atomic.Uint64
+
+// Dropped returns how many entries the sampler of the loggers built by New
+// has dropped
+func Dropped() uint64 {
+	return droppedEntries.Load()
+}
+
+// countDropped wraps the sampling hook of a logger to count dropped entries
+func countDropped(hook func(zapcore.Entry, zapcore.SamplingDecision)) func(zapcore.Entry, zapcore.SamplingDecision) {
+	return func(entry zapcore.Entry, decision zapcore.SamplingDecision) {
+		if decision&zapcore.LogDropped != 0 {
+			droppedEntries.Add(1)
+		}
+		if hook != nil {
+			hook(entry, decision)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package logger
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// levels are the minimum level and the overrides of named loggers of a
+// logger built by New, and of its children
+type levels struct {
+	level     zap.AtomicLevel
+	overrides atomic.Pointer[map[string]zapcore.Level]
+}
+
+func newLevels() *levels {
+	return &levels{level: zap.NewAtomicLevel()}
+}
+
+// active are the levels of the default logger, changed by the package level
+// functions
+var active atomic.Pointer[levels]
+
+func init() {
+	active.Store(newLevels())
+}
+
+// SetLevel changes the minimum level of the default logger at runtime
+func SetLevel(l string) error {
+	return active.Load().setLevel(l)
+}
+
+// Level returns the minimum level of the default logger
+func Level() string {
+	return active.Load().level.Level().String()
+}
+
+// SetPackageLevels replaces the level overrides of the named children of the
+// default logger. A logger named "database.bulk" uses the override of
+// "database.bulk", else of "database", else the level of the logger.
+func SetPackageLevels(levels map[string]string) error {
+	return active.Load().setOverrides(levels)
+}
+
+// PackageLevels returns the level overrides of the default logger
+func PackageLevels() map[string]string {
+	levels := map[string]string{}
+	if current := active.Load().overrides.Load(); current != nil {
+		for name, l := range *current {
+			levels[name] = l.String()
+		}
+	}
+	return levels
+}
+
+// Named returns a child of the default logger whose level can be overridden
+// with SetPackageLevels
+func Named(name string) *zap.Logger {
+	return get().WithOptions(zap.AddCallerSkip(-1)).Named(name)
+}
+
+func (lv *levels) setLevel(l string) error {
+	parsed, err := zapcore.ParseLevel(l)
+	if err != nil {
+		return err
+	}
+	lv.level.SetLevel(parsed)
+	return nil
+}
+
+func (lv *levels) setOverrides(levels map[string]string) error {
+	parsed := make(map[string]zapcore.Level, len(levels))
+	for name, l := range levels {
+		lvl, err := zapcore.ParseLevel(l)
+		if err != nil {
+			return err
+		}
+		parsed[strings.ToLower(name)] = lvl
+	}
+	lv.overrides.Store(&parsed)
+	return nil
+}
+
+// enabled reports whether a logger named name logs at l
+func (lv *levels) enabled(name string, l zapcore.Level) bool {
+	current := lv.overrides.Load()
+	if current == nil || len(*current) == 0 {
+		return lv.level.Enabled(l)
+	}
+	name = strings.ToLower(name)
+	for name != "" {
+		if override, ok := (*current)[name]; ok {
+			return override.Enabled(l)
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return lv.level.Enabled(l)
+}
+
+// minLevel is the lowest level any logger may log at
+func (lv *levels) minLevel() zapcore.Level {
+	lowest := lv.level.Level()
+	if current := lv.overrides.Load(); current != nil {
+		for _, l := range *current {
+			if l < lowest {
+				lowest = l
+			}
+		}
+	}
+	return lowest
+}
+
+// levelCore filters entries by the levels of its logger and the override of
+// their logger name. The wrapped core is built enabled at every level.
+type levelCore struct {
+	zapcore.Core
+	levels *levels
+}
+
+func (c levelCore) Enabled(l zapcore.Level) bool {
+	return l >= c.levels.minLevel()
+}
+
+func (c levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return levelCore{c.Core.With(fields), c.levels}
+}
+
+func (c levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.levels.enabled(entry.LoggerName, entry.Level) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
@@ -0,0 +1,106 @@
+package logger
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// observedLogger returns a logger filtered by lv and the entries it writes
+func observedLogger(lv *levels) (*zap.Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	return zap.New(levelCore{core, lv}), logs
+}
+
+func TestLevels(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     string
+		overrides map[string]string
+		logger    string
+		logged    []zapcore.Level
+	}{
+		{name: "level", level: "warn", logged: []zapcore.Level{zapcore.WarnLevel, zapcore.ErrorLevel}},
+		{name: "unrelated override", level: "warn", overrides: map[string]string{"database": "debug"}, logger: "http", logged: []zapcore.Level{zapcore.WarnLevel, zapcore.ErrorLevel}},
+		{name: "lower override", level: "warn", overrides: map[string]string{"database": "debug"}, logger: "database", logged: []zapcore.Level{zapcore.DebugLevel, zapcore.InfoLevel, zapcore.WarnLevel, zapcore.ErrorLevel}},
+		{name: "higher override", level: "debug", overrides: map[string]string{"database": "error"}, logger: "database", logged: []zapcore.Level{zapcore.ErrorLevel}},
+		{name: "parent override", level: "info", overrides: map[string]string{"database": "error"}, logger: "database.bulk", logged: []zapcore.Level{zapcore.ErrorLevel}},
+		{name: "nearest override", level: "info", overrides: map[string]string{"database": "error", "database.bulk": "debug"}, logger: "database.bulk", logged: []zapcore.Level{zapcore.DebugLevel, zapcore.InfoLevel, zapcore.WarnLevel, zapcore.ErrorLevel}},
+		{name: "override name case", level: "info", overrides: map[string]string{"Database": "error"}, logger: "database", logged: []zapcore.Level{zapcore.ErrorLevel}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lv := newLevels()
+			if err := lv.setLevel(tt.level); err != nil {
+				t.Fatal(err)
+			}
+			if err := lv.setOverrides(tt.overrides); err != nil {
+				t.Fatal(err)
+			}
+			l, logs := observedLogger(lv)
+			l = l.Named(tt.logger)
+			l.Debug("debug")
+			l.Info("info")
+			l.Warn("warn")
+			l.Error("error")
+
+			entries := logs.All()
+			if len(entries) != len(tt.logged) {
+				t.Fatalf("logged %d entries, want %v", len(entries), tt.logged)
+			}
+			for i, entry := range entries {
+				if entry.Level != tt.logged[i] {
+					t.Errorf("entry %d level = %v, want %v", i, entry.Level, tt.logged[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSetLevelAtRuntime(t *testing.T) {
+	lv := newLevels()
+	previous := active.Load()
+	t.Cleanup(func() { active.Store(previous) })
+	active.Store(lv)
+	l, logs := observedLogger(lv)
+	db := l.Named("database")
+
+	l.Debug("before")
+	if err := SetLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	l.Debug("after")
+	if err := SetPackageLevels(map[string]string{"database": "error"}); err != nil {
+		t.Fatal(err)
+	}
+	db.Info("overridden")
+	l.Debug("not overridden")
+
+	if got := Level(); got != "debug" {
+		t.Errorf("Level = %q, want debug", got)
+	}
+	if got := PackageLevels(); len(got) != 1 || got["database"] != "error" {
+		t.Errorf("PackageLevels = %v, want database=error", got)
+	}
+	var messages []string
+	for _, entry := range logs.All() {
+		messages = append(messages, entry.Message)
+	}
+	if len(messages) != 2 || messages[0] != "after" || messages[1] != "not overridden" {
+		t.Errorf("logged %v, want [after not overridden]", messages)
+	}
+
+	for _, bad := range []func() error{
+		func() error { return SetLevel("loud") },
+		func() error { return SetPackageLevels(map[string]string{"database": "loud"}) },
+	} {
+		if err := bad(); err == nil {
+			t.Error("invalid level accepted")
+		}
+	}
+	if got := Level(); got != "debug" {
+		t.Errorf("Level after an invalid change = %q, want debug", got)
+	}
+}
@@ -1,90 +1,188 @@
 package logger
 
 import (
+	"context"
+	"sync/atomic"
+
 	"github.com/gin-gonic/gin"
+	"github.com/robertantonyjaikumar/hangover-common/claims"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
-var zapLog *zap.Logger
+// zapLog backs the package level functions. It is built with default Options
+// on first use unless SetDefault was called before.
+var zapLog atomic.Pointer[zap.Logger]
+
+// Options configures New
+type Options struct {
+	// Level is the minimum enabled level, defaults to info
+	Level string
+	// Encoding is json or console, defaults to json
+	Encoding string
+	// OutputPaths defaults to stderr
+	OutputPaths []string
+	// Development builds zap's development config instead of the production one
+	Development bool
+	// Sampling keeps the first Initial entries with the same level and message
+	// each second, then every Thereafter-th. Nil keeps zap's default, an
+	// Initial of 0 disables sampling.
+	Sampling *zap.SamplingConfig
+	// Packages overrides the level of named loggers, see SetPackageLevels
+	Packages map[string]string
+}
 
-func init() {
-	var err error
+// New builds a logger from opts with its own level. Once passed to SetDefault
+// its level can be changed at runtime with SetLevel and SetPackageLevels.
+func New(opts Options) (*zap.Logger, error) {
+	return build(opts, newLevels())
+}
 
+// build builds a logger from opts filtered by lv
+func build(opts Options, lv *levels) (*zap.Logger, error) {
 	productionConfig := zap.NewProductionConfig()
-	encoderConfig := zap.NewProductionEncoderConfig()
-	productionConfig.EncoderConfig = encoderConfig
+	if opts.Development {
+		productionConfig = zap.NewDevelopmentConfig()
+	} else {
+		productionConfig.EncoderConfig = zap.NewProductionEncoderConfig()
+	}
+	if opts.Level == "" && opts.Development {
+		opts.Level = "debug"
+	}
+	if opts.Level != "" {
+		if err := lv.setLevel(opts.Level); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Packages != nil {
+		if err := lv.setOverrides(opts.Packages); err != nil {
+			return nil, err
+		}
+	}
+	// levelCore does the filtering
+	productionConfig.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	if opts.Encoding != "" {
+		productionConfig.Encoding = opts.Encoding
+	}
+	if len(opts.OutputPaths) > 0 {
+		productionConfig.OutputPaths = opts.OutputPaths
+	}
+	if opts.Sampling != nil {
+		productionConfig.Sampling = opts.Sampling
+		if opts.Sampling.Initial <= 0 {
+			productionConfig.Sampling = nil
+		}
+	}
+	if productionConfig.Sampling != nil {
+		sampling := *productionConfig.Sampling
+		sampling.Hook = countDropped(sampling.Hook)
+		productionConfig.Sampling = &sampling
+	}
+	return productionConfig.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return levelCore{core, lv}
+	}))
+}
 
-	zapLog, err = productionConfig.Build(zap.AddCallerSkip(1))
+// SetDefault makes l the logger of the package level functions, and its
+// levels the ones changed by SetLevel and SetPackageLevels
+func SetDefault(l *zap.Logger) {
+	activate(l)
+	zapLog.Store(l.WithOptions(zap.AddCallerSkip(1)))
+}
+
+// activate makes the levels of l, when built by New, the active ones
+func activate(l *zap.Logger) {
+	if core, ok := l.Core().(levelCore); ok {
+		active.Store(core.levels)
+	}
+}
+
+func get() *zap.Logger {
+	if l := zapLog.Load(); l != nil {
+		return l
+	}
+	// built with the active levels so earlier SetLevel calls apply
+	l, err := build(Options{}, active.Load())
 	if err != nil {
 		panic(err)
 	}
-
+	zapLog.CompareAndSwap(nil, l.WithOptions(zap.AddCallerSkip(1)))
+	return zapLog.Load()
 }
 
-type JwtSessionPayload struct {
-	TID  string `json:"tid"  binding:"required"`
-	Type string `json:"type" binding:"required"`
-	RID  string `json:"rid"  binding:"required"`
-	SID  string `json:"sid"  binding:"required"`
-}
+// Deprecated: use claims.Session
+type JwtSessionPayload = claims.Session
 
 func GetZapLogger() *zap.Logger {
-	return zapLog
+	return get()
 }
 
 func Info(message string, fields ...zap.Field) {
-	zapLog.Info(message, fields...)
+	get().Info(message, fields...)
 }
 
 func Debug(message string, fields ...zap.Field) {
-	zapLog.Debug(message, fields...)
+	get().Debug(message, fields...)
 }
 
 func Error(message string, fields ...zap.Field) {
-	zapLog.Error(message, fields...)
+	get().Error(message, fields...)
 }
 
 func Fatal(message string, fields ...zap.Field) {
-	zapLog.Fatal(message, fields...)
+	get().Fatal(message, fields...)
 }
 
 func Panic(message string, fields ...zap.Field) {
-	zapLog.Panic(message, fields...)
+	get().Panic(message, fields...)
 }
 func DPanic(message string, fields ...zap.Field) {
-	zapLog.Panic(message, fields...)
+	get().Panic(message, fields...)
 }
 func InfoWithSessionCtx(ctx *gin.Context, message string, fields ...zap.Field) {
-	generatedFields := generateFields(ctx, fields...)
-	zapLog.Info(message, generatedFields...)
+	l, generatedFields := generateFields(ctx, fields...)
+	l.Info(message, generatedFields...)
 }
 
 func DebugWithSessionCtx(ctx *gin.Context, message string, fields ...zap.Field) {
-	generatedFields := generateFields(ctx, fields...)
-	zapLog.Debug(message, generatedFields...)
+	l, generatedFields := generateFields(ctx, fields...)
+	l.Debug(message, generatedFields...)
 }
 
 func ErrorWithSessionCtx(ctx *gin.Context, message string, fields ...zap.Field) {
-	generatedFields := generateFields(ctx, fields...)
-	zapLog.Error(message, generatedFields...)
+	l, generatedFields := generateFields(ctx, fields...)
+	l.Error(message, generatedFields...)
 }
 
 func FatalWithSessionCtx(ctx *gin.Context, message string, fields ...zap.Field) {
-	generatedFields := generateFields(ctx, fields...)
-	zapLog.Fatal(message, generatedFields...)
+	l, generatedFields := generateFields(ctx, fields...)
+	l.Fatal(message, generatedFields...)
 }
 
-func generateFields(ctx *gin.Context, fields ...zap.Field) []zap.Field {
-	if ctx != nil {
-		claimPayload, exists := ctx.Get("x-claim-payload-log")
-		if !exists {
-			return fields
-		}
-
-		jwtSessionPayload, _ := claimPayload.(JwtSessionPayload)
+// generateFields returns the logger of ctx with fields. When ctx carries no
+// request scoped logger, which already has them, the claims of ctx are added.
+func generateFields(ctx *gin.Context, fields ...zap.Field) (*zap.Logger, []zap.Field) {
+	if ctx == nil {
+		return get(), fields
+	}
+	l, ok := fromContext(ctx)
+	if ok {
+		return l, fields
+	}
+	return l, append(ClaimFields(ctx), fields...)
+}
 
-		contextField := zap.Any("session_id", jwtSessionPayload.SID)
-		return append([]zap.Field{contextField}, fields...)
+// ClaimFields returns the session, tenant and role of the claims of ctx
+func ClaimFields(ctx context.Context) []zap.Field {
+	if session, ok := claims.SessionFrom(ctx); ok {
+		return []zap.Field{
+			zap.String("session_id", session.SID),
+			zap.String("tenant_id", session.TID),
+			zap.String("role_id", session.RID),
+		}
+	}
+	if auth, ok := claims.AuthFrom(ctx); ok {
+		return []zap.Field{zap.String("tenant_id", auth.TID)}
 	}
 	return nil
 }
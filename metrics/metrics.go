@@ -0,0 +1,220 @@
+// Package metrics records request count, latency and in-flight requests of
+// gin routes and serves them for Prometheus with the Go runtime, process and
+// database pool metrics.
+//
+//	cfg, err := config.LoadMetricsConfig()
+//	r.Use(metrics.Middleware(cfg))
+//	metrics.RegisterRoutes(r, cfg)
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/robertantonyjaikumar/hangover-common/config"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"go.uber.org/zap"
+)
+
+// unmatchedRoute labels the requests that match no route, so unknown paths
+// do not each create a series
+const unmatchedRoute = "unmatched"
+
+// Registry holds the metrics served by Handler. Register the metrics of the
+// service on it to serve them too.
+var Registry = newRegistry()
+
+// LogLinesDropped counts the log lines not written, by reason, such as sampled
+// and deduplicated by the body logger. Lines dropped by the logger sampler are
+// counted as rate_limited when collected.
+var LogLinesDropped = newDroppedCollector(logger.Dropped)
+
+var dbStats = struct {
+	sync.Mutex
+	collectors map[string]prometheus.Collector
+}{collectors: map[string]prometheus.Collector{}}
+
+func newRegistry() *prometheus.Registry {
+	r := prometheus.NewRegistry()
+	r.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return r
+}
+
+// droppedCollector adds the entries dropped by the logger sampler since the
+// last collection to the rate_limited count of LogLinesDropped
+type droppedCollector struct {
+	*prometheus.CounterVec
+	dropped func() uint64
+	mu      sync.Mutex
+	counted uint64
+}
+
+func newDroppedCollector(dropped func() uint64) *prometheus.CounterVec {
+	c := &droppedCollector{
+		CounterVec: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "log_lines_dropped_total",
+			Help: "Log lines not written, by reason.",
+		}, []string{"reason"}),
+		dropped: dropped,
+	}
+	Registry.MustRegister(c)
+	return c.CounterVec
+}
+
+func (c *droppedCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	if n := c.dropped(); n > c.counted {
+		c.WithLabelValues("rate_limited").Add(float64(n - c.counted))
+		c.counted = n
+	}
+	c.mu.Unlock()
+	c.CounterVec.Collect(ch)
+}
+
+type requestMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+}
+
+// newRequestMetrics registers the request metrics of cfg, reusing the ones
+// already registered under the same names
+func newRequestMetrics(cfg config.MetricsConfig) *requestMetrics {
+	buckets := cfg.Buckets
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	return &requestMetrics{
+		requests: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.Namespace,
+			Name:      "http_requests_total",
+			Help:      "Requests handled, by route template, method and status class.",
+		}, []string{"route", "method", "status"})),
+		duration: register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: cfg.Namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to handle requests, by route template, method and status class.",
+			Buckets:   buckets,
+		}, []string{"route", "method", "status"})),
+		inFlight: register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: cfg.Namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "Requests being handled, by route template and method.",
+		}, []string{"route", "method"})),
+	}
+}
+
+// register adds c to Registry, returning the collector registered before
+// under the same name when there is one
+func register[T prometheus.Collector](c T) T {
+	if err := Registry.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(T); ok {
+				return existing
+			}
+		}
+		logger.Error("could not register metric", zap.Error(err))
+	}
+	return c
+}
+
+// Middleware records every request not in cfg.SkipPaths under the route
+// template it matched, its method and its status class such as 2xx. The
+// metrics path is never recorded. Skip paths match the request path or the
+// route template, with or without cfg.BasePath.
+func Middleware(cfg config.MetricsConfig) gin.HandlerFunc {
+	if !cfg.Enabled {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	m := newRequestMetrics(cfg)
+	skipPaths := make(map[string]bool, 2*len(cfg.SkipPaths)+2)
+	for _, p := range append([]string{cfg.Path}, cfg.SkipPaths...) {
+		skipPaths[p] = true
+		if cfg.BasePath != "" {
+			skipPaths[path.Join(cfg.BasePath, p)] = true
+		}
+	}
+	return func(c *gin.Context) {
+		if skipPaths[c.Request.URL.Path] || skipPaths[c.FullPath()] {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := methodLabel(c.Request.Method)
+		inFlight := m.inFlight.WithLabelValues(route, method)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		c.Next()
+
+		status := StatusClass(c.Writer.Status())
+		m.requests.WithLabelValues(route, method, status).Inc()
+		m.duration.WithLabelValues(route, method, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// StatusClass returns the class of an HTTP status, such as 2xx
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// methodLabel returns method, or OTHER for non standard methods
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// Handler serves the metrics of Registry in the Prometheus format
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
+}
+
+// RegisterRoutes serves Handler on cfg.Path
+func RegisterRoutes(r gin.IRouter, cfg config.MetricsConfig) {
+	r.GET(cfg.Path, Handler())
+}
+
+// RegisterDB exports the pool stats of db labelled db_name=name, such as its
+// database registry name, and db_role=role, such as master, source or
+// replica. It replaces the pool registered before under the same labels.
+func RegisterDB(name, role string, db *sql.DB) {
+	key := name + "/" + role
+	r := prometheus.WrapRegistererWith(prometheus.Labels{"db_role": role}, Registry)
+	dbStats.Lock()
+	defer dbStats.Unlock()
+	if old, ok := dbStats.collectors[key]; ok {
+		r.Unregister(old)
+	}
+	c := collectors.NewDBStatsCollector(db, name)
+	if err := r.Register(c); err != nil {
+		logger.Error("could not register database pool metrics", zap.String("db_name", name), zap.String("db_role", role), zap.Error(err))
+		return
+	}
+	dbStats.collectors[key] = c
+}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/robertantonyjaikumar/hangover-common/config"
+)
+
+func TestMiddlewareSkipPaths(t *testing.T) {
+	cfg := config.MetricsConfig{Enabled: true, Path: "/metrics", Namespace: "skip_test", SkipPaths: []string{"/health"}, BasePath: "/api"}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware(cfg))
+	api := r.Group(cfg.BasePath)
+	api.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+	api.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	RegisterRoutes(api, cfg)
+
+	for _, target := range []string{"/api/health", "/api/metrics", "/api/users/1", "/api/users/2", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	m := newRequestMetrics(cfg)
+	tests := []struct {
+		route string
+		want  float64
+	}{
+		{"/api/health", 0},
+		{"/api/metrics", 0},
+		{"/api/users/:id", 2},
+		{unmatchedRoute, 1},
+	}
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(m.requests.WithLabelValues(tt.route, http.MethodGet, StatusClass(statusOf(tt.route)))); got != tt.want {
+			t.Errorf("requests of %s = %v, want %v", tt.route, got, tt.want)
+		}
+	}
+}
+
+func statusOf(route string) int {
+	if route == unmatchedRoute {
+		return http.StatusNotFound
+	}
+	return http.StatusOK
+}
+
+func TestStatusClass(t *testing.T) {
+	tests := map[int]string{0: "unknown", 99: "unknown", 100: "1xx", 204: "2xx", 404: "4xx", 599: "5xx", 600: "unknown"}
+	for status, want := range tests {
+		if got := StatusClass(status); got != want {
+			t.Errorf("StatusClass(%d) = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestDroppedCollector(t *testing.T) {
+	var dropped uint64
+	c := &droppedCollector{
+		CounterVec: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "log_lines_dropped_total", Help: "Log lines not written, by reason."}, []string{"reason"}),
+		dropped:    func() uint64 { return dropped },
+	}
+	c.WithLabelValues("sampled").Add(2)
+	c.WithLabelValues("rate_limited").Add(1)
+
+	for _, step := range []struct {
+		dropped uint64
+		want    float64
+	}{{0, 1}, {3, 4}, {3, 4}, {5, 6}} {
+		dropped = step.dropped
+		// a second rate_limited series would fail the collection
+		want := fmt.Sprintf(`# HELP log_lines_dropped_total Log lines not written, by reason.
+# TYPE log_lines_dropped_total counter
+log_lines_dropped_total{reason="rate_limited"} %v
+log_lines_dropped_total{reason="sampled"} 2
+`, step.want)
+		if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+			t.Errorf("after %d dropped: %v", step.dropped, err)
+		}
+	}
+}
+
+func TestRegisterDB(t *testing.T) {
+	pool := func() *sql.DB {
+		db, err := sql.Open("pgx", "host=127.0.0.1 port=1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	RegisterDB("register_test", "master", pool())
+	RegisterDB("register_test@h1", "source", pool())
+	RegisterDB("register_test@h1", "replica", pool())
+	// replaces the replica pool
+	replica := pool()
+	replica.SetMaxOpenConns(7)
+	RegisterDB("register_test@h1", "replica", replica)
+
+	families, err := Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "go_sql_max_open_connections" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if strings.HasPrefix(labels["db_name"], "register_test") {
+				got[labels["db_name"]+" "+labels["db_role"]] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	want := map[string]float64{
+		"register_test master":     0,
+		"register_test@h1 source":  0,
+		"register_test@h1 replica": 7,
+	}
+	if len(got) != len(want) {
+		t.Errorf("pools = %v, want %v", got, want)
+	}
+	for pool, value := range want {
+		if v, ok := got[pool]; !ok || v != value {
+			t.Errorf("max open connections of %s = %v, want %v", pool, v, value)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
@@ -11,12 +12,16 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
+	"github.com/robertantonyjaikumar/hangover-common/claims"
 	"github.com/robertantonyjaikumar/hangover-common/config"
 	"github.com/robertantonyjaikumar/hangover-common/logger"
 	"go.uber.org/zap"
 )
 
+// AuthMiddleware verifies the client token of the request with the
+// ACCESS_SECRET read when it is built
 func AuthMiddleware() gin.HandlerFunc {
+	keyFunc := accessKeyFunc(loadAccessSecret())
 	return func(c *gin.Context) {
 		bearerToken := c.Request.Header.Get("Authorization")
 		bearerToken = strings.ReplaceAll(bearerToken, "Bearer ", "")
@@ -28,14 +33,17 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		claimPayload, err := ValidateToken(bearerToken)
+		claimPayload, err := validateToken(bearerToken, keyFunc)
 		if err != nil {
 			c.AbortWithStatus(401)
 			return
 		}
 
-		c.Set("x-claim-payload", claimPayload)
+		c.Set(claims.AuthKey, claimPayload)
 		c.Set("x-token", bearerToken)
+		if _, ok := c.Get(logger.GinKey); ok {
+			addLogTenant(c, claimPayload.TID)
+		}
 
 		c.Next()
 	}
@@ -132,17 +140,42 @@ func ClientMiddleware() gin.HandlerFunc {
 	}
 }
 
+// errNoAccessSecret rejects every token while ACCESS_SECRET is not set, an
+// empty HMAC key would verify tokens signed by anyone
+var errNoAccessSecret = errors.New("auth: ACCESS_SECRET is not configured")
+
+// loadAccessSecret returns ACCESS_SECRET, logging the auth config errors
+func loadAccessSecret() string {
+	cfg, err := config.LoadAuthConfigE()
+	if err != nil {
+		logger.Error("invalid auth config", zap.Error(err))
+	}
+	return cfg.AccessSecret
+}
+
+// accessKeyFunc returns the key function verifying access tokens with secret,
+// refusing other signing methods and an empty secret
+func accessKeyFunc(secret string) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("auth: unexpected signing method %v", token.Header["alg"])
+		}
+		if secret == "" {
+			return nil, errNoAccessSecret
+		}
+		return []byte(secret), nil
+	}
+}
+
+// ValidateToken verifies a client token with the configured ACCESS_SECRET,
+// read on every call. AuthMiddleware reads it once.
 func ValidateToken(tokenString string) (JwtAuthPayload, error) {
-	cfg := config.LoadAuthConfig()
-	var jwtKey = []byte(cfg.AccessSecret)
+	return validateToken(tokenString, accessKeyFunc(loadAccessSecret()))
+}
+
+func validateToken(tokenString string, keyFunc jwt.Keyfunc) (JwtAuthPayload, error) {
 	claims := jwt.MapClaims{}
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		claims,
-		func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		},
-	)
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyFunc)
 
 	if err != nil {
 		return JwtAuthPayload{}, err
@@ -164,16 +197,8 @@ func ValidateToken(tokenString string) (JwtAuthPayload, error) {
 }
 
 func ValidateSessionToken(tokenString string) (JwtSessionPayload, error) {
-	cfg := config.LoadAuthConfig()
-	var jwtKey = []byte(cfg.AccessSecret)
 	claims := jwt.MapClaims{}
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		claims,
-		func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		},
-	)
+	token, err := jwt.ParseWithClaims(tokenString, claims, accessKeyFunc(loadAccessSecret()))
 
 	if err != nil {
 		logger.Error("Validate Session Token failed", zap.Error(err))
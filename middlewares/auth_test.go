@@ -0,0 +1,40 @@
+package middlewares
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func TestValidateTokenKeyFunc(t *testing.T) {
+	sign := func(method jwt.SigningMethod, key interface{}) string {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{"Payload": map[string]interface{}{"tid": "acme", "type": "service", "cid": "c1"}})
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	tests := []struct {
+		name    string
+		token   string
+		secret  string
+		wantErr bool
+	}{
+		{"valid", sign(jwt.SigningMethodHS256, []byte("s3cret")), "s3cret", false},
+		{"wrong secret", sign(jwt.SigningMethodHS256, []byte("other")), "s3cret", true},
+		{"secret not configured", sign(jwt.SigningMethodHS256, []byte("")), "", true},
+		{"unsigned", sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType), "s3cret", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := validateToken(tt.token, accessKeyFunc(tt.secret))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateToken error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (payload.TID != "acme" || payload.CID != "c1") {
+				t.Errorf("payload = %+v", payload)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package middlewares
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// TruncatedMarker ends logged form bodies cut at the capture limit
+	TruncatedMarker = "...[TRUNCATED]"
+	// TruncatedBody replaces JSON bodies cut at the capture limit, which can
+	// not be redacted reliably
+	TruncatedBody = "[truncated, not logged]"
+	// UnparsableBody replaces bodies that are not valid JSON
+	UnparsableBody = "[unparsable, not logged]"
+)
+
+// captureWriter keeps up to limit bytes of a response whose content type is
+// captured and counts the bytes written. Once the handler flushes, the
+// response is streamed and nothing more is kept.
+type captureWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	limit     int
+	captures  func(header http.Header) bool
+	checked   bool
+	capturing bool
+	truncated bool
+	flushed   bool
+	written   int64
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.capture(b)
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	n, err := w.ResponseWriter.WriteString(s)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *captureWriter) Flush() {
+	w.checked = true
+	w.capturing = false
+	w.flushed = true
+	w.body.Reset()
+	w.ResponseWriter.Flush()
+}
+
+func (w *captureWriter) capture(b []byte) {
+	if !w.checked {
+		w.checked = true
+		w.capturing = w.captures(w.Header())
+	}
+	if !w.capturing {
+		return
+	}
+	if room := w.limit - w.body.Len(); len(b) > room {
+		w.body.Write(b[:room])
+		w.truncated = true
+		w.capturing = false
+		return
+	}
+	w.body.Write(b)
+}
+
+// countingBody counts the bytes read from a request body, which
+// ContentLength does not give for chunked requests
+type countingBody struct {
+	io.ReadCloser
+	read int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	return n, err
+}
+
+// countRequest wraps the body of r to count the bytes the handlers read
+func countRequest(r *http.Request) *countingBody {
+	body := &countingBody{ReadCloser: http.NoBody}
+	if r.Body != nil && r.Body != http.NoBody {
+		body.ReadCloser = r.Body
+		r.Body = body
+	}
+	return body
+}
+
+// captureRequest reads up to limit bytes of the request body and puts them
+// back in front of the rest of it. It reports whether the body is longer.
+func captureRequest(r *http.Request, limit int) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, false
+	}
+	captured, _ := io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(captured), r.Body), r.Body}
+	if len(captured) > limit {
+		return captured[:limit], true
+	}
+	return captured, false
+}
+
+// contentTypeFilter matches media types against allowed and denied patterns,
+// * matches any characters: application/json, text/*, application/*+json
+type contentTypeFilter struct {
+	allow []string
+	deny  []string
+}
+
+// captures reports whether a body sent with header is logged. Compressed
+// bodies are never logged.
+func (f contentTypeFilter) captures(header http.Header) bool {
+	if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if matchesMediaType(f.deny, mediaType) {
+		return false
+	}
+	return len(f.allow) == 0 || matchesMediaType(f.allow, mediaType)
+}
+
+func matchesMediaType(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), mediaType); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package middlewares
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ginzap "github.com/gin-contrib/zap"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestCaptureWriter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name        string
+		contentType string
+		writes      []string
+		flush       bool
+		body        string
+		truncated   bool
+	}{
+		{name: "under the limit", contentType: "application/json", writes: []string{`{"a":`, `1}`}, body: `{"a":1}`},
+		{name: "at the limit", contentType: "application/json", writes: []string{"0123456789"}, body: "0123456789"},
+		{name: "over the limit", contentType: "application/json", writes: []string{"01234", "56789", "ab"}, body: "0123456789", truncated: true},
+		{name: "skipped content type", contentType: "image/png", writes: []string{"png"}},
+		{name: "flushed", contentType: "text/event-stream", writes: []string{"data: 1\n\n"}, flush: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			filter := contentTypeFilter{deny: []string{"image/*"}}
+			cw := &captureWriter{ResponseWriter: c.Writer, limit: 10, captures: filter.captures}
+			cw.Header().Set("Content-Type", tt.contentType)
+			var size int
+			for i, write := range tt.writes {
+				if i%2 == 0 {
+					cw.Write([]byte(write))
+				} else {
+					cw.WriteString(write)
+				}
+				size += len(write)
+			}
+			if tt.flush {
+				cw.Flush()
+			}
+			if got := cw.body.String(); got != tt.body || cw.truncated != tt.truncated {
+				t.Errorf("captured %q truncated %v, want %q truncated %v", got, cw.truncated, tt.body, tt.truncated)
+			}
+			if cw.written != int64(size) || rec.Body.Len() != size {
+				t.Errorf("written %d, sent %d, want %d", cw.written, rec.Body.Len(), size)
+			}
+			if cw.flushed != tt.flush {
+				t.Errorf("flushed = %v, want %v", cw.flushed, tt.flush)
+			}
+		})
+	}
+}
+
+func TestCaptureRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		limit     int
+		captured  string
+		truncated bool
+	}{
+		{name: "empty", limit: 4},
+		{name: "under the limit", body: "abc", limit: 4, captured: "abc"},
+		{name: "at the limit", body: "abcd", limit: 4, captured: "abcd"},
+		{name: "over the limit", body: "abcdef", limit: 4, captured: "abcd", truncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.body == "" {
+				r.Body = http.NoBody
+			}
+			captured, truncated := captureRequest(r, tt.limit)
+			if string(captured) != tt.captured || truncated != tt.truncated {
+				t.Errorf("captureRequest = %q, %v, want %q, %v", captured, truncated, tt.captured, tt.truncated)
+			}
+			if rest, _ := io.ReadAll(r.Body); string(rest) != tt.body {
+				t.Errorf("handler read %q, want the whole body %q", rest, tt.body)
+			}
+		})
+	}
+}
+
+func TestBodyLogMiddlewareSizes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zapcore.DebugLevel)
+	opts := DefaultBodyLogOptions()
+	opts.MaxRequestBody, opts.MaxResponseBody = 8, 8
+	r := gin.New()
+	r.Use(BodyLogMiddleware(zap.New(core), &ginzap.Config{}, opts))
+	r.POST("/echo", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Data(http.StatusOK, "application/json", append(body, body...))
+	})
+
+	// a chunked request has no ContentLength
+	req := httptest.NewRequest(http.MethodPost, "/echo", io.NopCloser(strings.NewReader(`{"id":12345}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("logged %d entries, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	want := map[string]interface{}{
+		"request-body-size":       int64(12),
+		"request-body-truncated":  true,
+		"response-body-size":      int64(24),
+		"response-body-truncated": true,
+		"response-body":           TruncatedBody,
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("%s = %v, want %v", key, fields[key], value)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/robertantonyjaikumar/hangover-common/claims"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"github.com/robertantonyjaikumar/hangover-common/requestid"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader carries the ID of a request
+const RequestIDHeader = requestid.Header
+
+// loggedTenantKey holds the tenant already added to the request scoped logger
+const loggedTenantKey = "x-logger-tenant"
+
+// ContextLoggerMiddleware puts a request scoped logger, returned by
+// logger.FromContext for the request context and the gin context, carrying
+// the request ID, route and the claims present when it runs. Claims set later
+// reach it through AuthMiddleware and SetSessionClaims.
+func ContextLoggerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("route", c.FullPath()),
+		}
+		if id := requestid.FromContext(c); id != "" {
+			fields = append(fields, zap.String("request_id", id))
+		} else if id := c.GetHeader(RequestIDHeader); requestid.Valid(id) {
+			fields = append(fields, zap.String("request_id", id))
+		}
+		if session, ok := claims.SessionFrom(c); ok {
+			fields = append(fields, zap.String("session_id", session.SID), zap.String("role_id", session.RID))
+		}
+		AddLogFields(c, fields...)
+		addLogTenant(c, claims.TenantFrom(c))
+		c.Next()
+	}
+}
+
+// RequestIDMiddleware accepts the X-Request-ID of the request, or generates
+// one when missing or invalid, and echoes it in the response. The ID is put
+// on the gin context, the request context and the request scoped logger.
+// Propagate it with requestid.Transport and database.request_id_comments.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Set(requestid.GinKey, id)
+		c.Request = c.Request.WithContext(requestid.WithContext(c.Request.Context(), id))
+		if _, ok := c.Get(logger.GinKey); ok {
+			AddLogFields(c, zap.String("request_id", id))
+		}
+		c.Next()
+	}
+}
+
+// AddLogFields adds fields to the request scoped logger of c
+func AddLogFields(c *gin.Context, fields ...zap.Field) {
+	logger.WithGinContext(c, fields...)
+}
+
+// SetSessionClaims stores the session claims of the request and adds them to
+// its request scoped logger
+func SetSessionClaims(c *gin.Context, session claims.Session) {
+	c.Set(claims.SessionKey, session)
+	if _, ok := c.Get(logger.GinKey); !ok {
+		return
+	}
+	AddLogFields(c, zap.String("session_id", session.SID), zap.String("role_id", session.RID))
+	addLogTenant(c, session.TID)
+}
+
+// contextFields returns the fields registered with logger.AddContextFields,
+// such as trace IDs
+func contextFields(c *gin.Context) []zap.Field {
+	return logger.ContextFields(c)
+}
+
+// addLogTenant adds tenant to the request scoped logger unless it has it already
+func addLogTenant(c *gin.Context, tenant string) {
+	if tenant == "" || c.GetString(loggedTenantKey) == tenant {
+		return
+	}
+	AddLogFields(c, zap.String("tenant_id", tenant))
+	c.Set(loggedTenantKey, tenant)
+}
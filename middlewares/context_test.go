@@ -0,0 +1,128 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robertantonyjaikumar/hangover-common/claims"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"github.com/robertantonyjaikumar/hangover-common/requestid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestContextLoggerMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger.SetDefault(zap.New(core))
+	session := claims.Session{TID: "acme", RID: "admin", SID: "s1"}
+
+	tests := []struct {
+		name      string
+		requestID string
+		before    func(c *gin.Context)
+		after     func(c *gin.Context)
+		want      map[string]interface{}
+	}{
+		{
+			name:      "request",
+			requestID: "req-1",
+			want:      map[string]interface{}{"method": "GET", "route": "/orders/:id", "request_id": "req-1"},
+		},
+		{
+			name:      "invalid request id",
+			requestID: "bad id\n",
+			want:      map[string]interface{}{"method": "GET", "route": "/orders/:id"},
+		},
+		{
+			name:   "claims present",
+			before: func(c *gin.Context) { c.Set(claims.SessionKey, session) },
+			want:   map[string]interface{}{"method": "GET", "route": "/orders/:id", "session_id": "s1", "role_id": "admin", "tenant_id": "acme"},
+		},
+		{
+			name:  "session claims set later",
+			after: func(c *gin.Context) { SetSessionClaims(c, session) },
+			want:  map[string]interface{}{"method": "GET", "route": "/orders/:id", "session_id": "s1", "role_id": "admin", "tenant_id": "acme"},
+		},
+		{
+			name:   "auth tenant",
+			before: func(c *gin.Context) { c.Set(claims.AuthKey, claims.Auth{TID: "globex"}) },
+			want:   map[string]interface{}{"method": "GET", "route": "/orders/:id", "tenant_id": "globex"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			if tt.before != nil {
+				r.Use(tt.before)
+			}
+			r.Use(ContextLoggerMiddleware())
+			if tt.after != nil {
+				r.Use(tt.after)
+			}
+			r.GET("/orders/:id", func(c *gin.Context) {
+				logger.FromContext(c.Request.Context()).Info("handled")
+			})
+			req := httptest.NewRequest(http.MethodGet, "/orders/1", nil)
+			if tt.requestID != "" {
+				req.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			entries := logs.TakeAll()
+			if len(entries) != 1 {
+				t.Fatalf("logged %d entries, want 1", len(entries))
+			}
+			got := entries[0].ContextMap()
+			if len(got) != len(tt.want) || len(entries[0].Context) != len(tt.want) {
+				t.Errorf("fields = %v, want %v", entries[0].Context, tt.want)
+			}
+			for key, value := range tt.want {
+				if got[key] != value {
+					t.Errorf("%s = %v, want %v", key, got[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name     string
+		header   string
+		accepted bool
+	}{
+		{name: "accepted", header: "req-1", accepted: true},
+		{name: "missing"},
+		{name: "invalid", header: "bad id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromGin, fromRequest string
+			r := gin.New()
+			r.Use(RequestIDMiddleware())
+			r.GET("/", func(c *gin.Context) {
+				fromGin = requestid.FromContext(c)
+				fromRequest = requestid.FromContext(c.Request.Context())
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			echoed := w.Header().Get(RequestIDHeader)
+			if !requestid.Valid(echoed) || (echoed == tt.header) != tt.accepted {
+				t.Errorf("response ID = %q, want accepted %v", echoed, tt.accepted)
+			}
+			if fromGin != echoed || fromRequest != echoed {
+				t.Errorf("gin context %q, request context %q, want %q", fromGin, fromRequest, echoed)
+			}
+		})
+	}
+}
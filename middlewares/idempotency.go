@@ -0,0 +1,194 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robertantonyjaikumar/hangover-common/claims"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"github.com/robertantonyjaikumar/hangover-common/structs"
+	"go.uber.org/zap"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyStoreTimeout bounds storing the outcome of a request, which
+// outlives its context so a client disconnect does not leave the key claimed
+const idempotencyStoreTimeout = 5 * time.Second
+
+// unreplayedHeaders are the response headers not stored with the response
+var unreplayedHeaders = []string{"Content-Length", "Date", "Set-Cookie"}
+
+// IdempotencyStore persists idempotency records, see database.IdempotencyStore
+type IdempotencyStore interface {
+	// Begin claims key within scope for a new request. When the key is already
+	// claimed the existing record is returned instead.
+	Begin(ctx context.Context, scope, key, fingerprint string, ttl time.Duration) (*structs.IdempotencyRecord, error)
+	// Complete stores the captured response of a claimed key
+	Complete(ctx context.Context, scope, key string, record structs.IdempotencyRecord) error
+	// Release drops a claimed key so the request can be retried
+	Release(ctx context.Context, scope, key string) error
+}
+
+type IdempotencyConfig struct {
+	Store IdempotencyStore
+	// TTL is how long a key and its response are kept. Defaults to 24 hours.
+	TTL time.Duration
+	// Methods that honour the header. Defaults to POST and PATCH.
+	Methods []string
+	// MaxResponseBody is the most bytes of a response stored for replay.
+	// Defaults to 1MiB. Longer and streamed responses are not stored, the key
+	// is released so the request can be retried.
+	MaxResponseBody int
+	// Scope returns the namespace of the key. Defaults to the authenticated
+	// caller: the tenant and subject of the session claims, else the tenant
+	// and client of the auth claims. An empty scope rejects the request.
+	Scope func(c *gin.Context) string
+}
+
+// IdempotencyMiddleware replays the stored response of requests repeated with
+// the same Idempotency-Key, with its headers such as Location and ETag. A
+// duplicate that arrives while the first request is
+// still running gets 409, a key reused for a different request gets 422.
+// Keys are scoped by caller, a request whose caller is not identified gets
+// 400: register the middleware after the auth ones.
+func IdempotencyMiddleware(conf IdempotencyConfig) gin.HandlerFunc {
+	if conf.TTL == 0 {
+		conf.TTL = 24 * time.Hour
+	}
+	if len(conf.Methods) == 0 {
+		conf.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if conf.MaxResponseBody == 0 {
+		conf.MaxResponseBody = 1 << 20
+	}
+	if conf.Scope == nil {
+		conf.Scope = defaultIdempotencyScope
+	}
+	methods := make(map[string]bool, len(conf.Methods))
+	for _, method := range conf.Methods {
+		methods[method] = true
+	}
+
+	return func(c *gin.Context) {
+		key := c.Request.Header.Get(IdempotencyKeyHeader)
+		if key == "" || !methods[c.Request.Method] {
+			c.Next()
+			return
+		}
+
+		scope := conf.Scope(c)
+		if scope == "" {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		request, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(request))
+
+		ctx := c.Request.Context()
+		fingerprint := requestFingerprint(c.Request, request)
+		existing, err := conf.Store.Begin(ctx, scope, key, fingerprint, conf.TTL)
+		if err != nil {
+			logger.ErrorWithSessionCtx(c, "idempotency key lookup failed", zap.String("key", key), zap.Error(err))
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				c.AbortWithStatus(http.StatusUnprocessableEntity)
+			case !existing.Completed:
+				c.AbortWithStatus(http.StatusConflict)
+			default:
+				for name, values := range existing.Headers {
+					c.Writer.Header()[name] = values
+				}
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(existing.Status, existing.ContentType, existing.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		cw := &captureWriter{
+			ResponseWriter: c.Writer,
+			limit:          conf.MaxResponseBody,
+			captures:       func(http.Header) bool { return true },
+		}
+		c.Writer = cw
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				storeCtx, cancel := idempotencyStoreContext(ctx)
+				defer cancel()
+				conf.Store.Release(storeCtx, scope, key)
+				panic(recovered)
+			}
+		}()
+		c.Next()
+
+		storeCtx, cancel := idempotencyStoreContext(ctx)
+		defer cancel()
+		if status := c.Writer.Status(); status >= http.StatusInternalServerError {
+			err = conf.Store.Release(storeCtx, scope, key)
+		} else if cw.truncated || cw.flushed {
+			logger.ErrorWithSessionCtx(c, "idempotent response too long to store, key released",
+				zap.String("key", key), zap.Int64("size", cw.written), zap.Bool("streamed", cw.flushed))
+			err = conf.Store.Release(storeCtx, scope, key)
+		} else {
+			err = conf.Store.Complete(storeCtx, scope, key, structs.IdempotencyRecord{
+				Fingerprint: fingerprint,
+				Completed:   true,
+				Status:      status,
+				ContentType: c.Writer.Header().Get("Content-Type"),
+				Headers:     replayedHeaders(c.Writer.Header()),
+				Body:        cw.body.Bytes(),
+			})
+		}
+		if err != nil {
+			logger.ErrorWithSessionCtx(c, "could not store idempotent response", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+// idempotencyStoreContext keeps the values of ctx but not its cancellation
+func idempotencyStoreContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), idempotencyStoreTimeout)
+}
+
+// replayedHeaders returns the response headers stored with the response
+func replayedHeaders(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range unreplayedHeaders {
+		header.Del(name)
+	}
+	return header
+}
+
+// defaultIdempotencyScope returns the tenant and user or client of c, empty
+// when the caller is not identified
+func defaultIdempotencyScope(c *gin.Context) string {
+	if session, ok := claims.SessionFrom(c); ok && session.Sub != "" {
+		return session.TID + "/user/" + session.Sub
+	}
+	if auth, ok := claims.AuthFrom(c); ok && auth.CID != "" {
+		return auth.TID + "/client/" + auth.CID
+	}
+	return ""
+}
+
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,144 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robertantonyjaikumar/hangover-common/claims"
+	"github.com/robertantonyjaikumar/hangover-common/structs"
+)
+
+// memoryIdempotencyStore keeps records in memory, keyed by scope and key
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]structs.IdempotencyRecord
+}
+
+func (s *memoryIdempotencyStore) Begin(_ context.Context, scope, key, fingerprint string, _ time.Duration) (*structs.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.records[scope+"|"+key]; ok {
+		return &record, nil
+	}
+	s.records[scope+"|"+key] = structs.IdempotencyRecord{Fingerprint: fingerprint}
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(_ context.Context, scope, key string, record structs.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[scope+"|"+key] = record
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(_ context.Context, scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, scope+"|"+key)
+	return nil
+}
+
+func TestIdempotencyMiddlewareScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &memoryIdempotencyStore{records: map[string]structs.IdempotencyRecord{}}
+	calls := 0
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if sub := c.GetHeader("X-Test-Sub"); sub != "" {
+			c.Set(claims.SessionKey, claims.Session{TID: "acme", SID: c.GetHeader("X-Test-Session"), Sub: sub})
+		}
+		if cid := c.GetHeader("X-Test-Client"); cid != "" {
+			c.Set(claims.AuthKey, claims.Auth{TID: "acme", Type: "service", CID: cid})
+		}
+	})
+	r.Use(IdempotencyMiddleware(IdempotencyConfig{Store: store}))
+	r.POST("/orders", func(c *gin.Context) {
+		calls++
+		c.Header("Location", "/orders/1")
+		c.String(http.StatusCreated, "created %d", calls)
+	})
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		status   int
+		body     string
+		replayed bool
+	}{
+		{"anonymous rejected", nil, http.StatusBadRequest, "", false},
+		{"session without subject rejected", map[string]string{"X-Test-Session": "s1"}, http.StatusBadRequest, "", false},
+		{"first user request", map[string]string{"X-Test-Sub": "u1", "X-Test-Session": "s1"}, http.StatusCreated, "created 1", false},
+		{"same user after login again", map[string]string{"X-Test-Sub": "u1", "X-Test-Session": "s2"}, http.StatusCreated, "created 1", true},
+		{"other user", map[string]string{"X-Test-Sub": "u2", "X-Test-Session": "s3"}, http.StatusCreated, "created 2", false},
+		{"client", map[string]string{"X-Test-Client": "c1"}, http.StatusCreated, "created 3", false},
+		{"same client", map[string]string{"X-Test-Client": "c1"}, http.StatusCreated, "created 3", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"sku":"a"}`))
+			req.Header.Set(IdempotencyKeyHeader, "k1")
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.status || w.Body.String() != tt.body {
+				t.Fatalf("response = %d %q, want %d %q", w.Code, w.Body.String(), tt.status, tt.body)
+			}
+			if replayed := w.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.replayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.replayed)
+			}
+			if tt.replayed && w.Header().Get("Location") != "/orders/1" {
+				t.Errorf("Location = %q, want the stored header", w.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestIdempotencyMiddlewareResponseLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		body   string
+		flush  bool
+		stored bool
+	}{
+		{name: "stored", body: "0123456789", stored: true},
+		{name: "too long", body: "0123456789a"},
+		{name: "streamed", body: "data", flush: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryIdempotencyStore{records: map[string]structs.IdempotencyRecord{}}
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				c.Set(claims.AuthKey, claims.Auth{TID: "acme", CID: "c1"})
+			})
+			r.Use(IdempotencyMiddleware(IdempotencyConfig{Store: store, MaxResponseBody: 10}))
+			r.POST("/export", func(c *gin.Context) {
+				c.String(http.StatusOK, tt.body)
+				if tt.flush {
+					c.Writer.Flush()
+				}
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/export", nil)
+			req.Header.Set(IdempotencyKeyHeader, "k1")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Body.String() != tt.body {
+				t.Errorf("response = %q, want %q", w.Body.String(), tt.body)
+			}
+			record, stored := store.records["acme/client/c1|k1"]
+			if stored != tt.stored || (stored && string(record.Body) != tt.body) {
+				t.Errorf("stored = %v %q, want %v", stored, record.Body, tt.stored)
+			}
+		})
+	}
+}
@@ -1,59 +1,169 @@
 package middlewares
 
 import (
-	"bytes"
 	"encoding/json"
 	ginzap "github.com/gin-contrib/zap"
 	"go.uber.org/zap/zapcore"
-	"io/ioutil"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/robertantonyjaikumar/hangover-common/config"
+	"github.com/robertantonyjaikumar/hangover-common/requestid"
 	"go.uber.org/zap"
 )
 
-type bodyLogWriter struct {
-	gin.ResponseWriter
-	body *bytes.Buffer
+// BodyLogOptions configures BodyLogMiddleware
+type BodyLogOptions struct {
+	Redaction RedactionRules `config:"redaction"`
+	// Routes overrides the redaction of routes, keyed by their template as
+	// registered, optionally prefixed by the method: "/users/:id", "POST /login".
+	// Keys are matched case insensitively, as viper lowercases them.
+	Routes map[string]RouteBodyLog `config:"routes" desc:"redaction of routes by template, optionally prefixed by the method"`
+	// LogHeaders adds the redacted request and response headers to the fields
+	LogHeaders bool `config:"log_headers" desc:"log the redacted request and response headers"`
+	// MaxRequestBody and MaxResponseBody are the most bytes of a body kept
+	// for the log. Longer form bodies end with TruncatedMarker, longer JSON
+	// bodies are replaced by TruncatedBody. 0 logs no body.
+	MaxRequestBody  int `config:"max_request_body" default:"65536" validate:"min=0" desc:"most bytes of a request body logged"`
+	MaxResponseBody int `config:"max_response_body" default:"65536" validate:"min=0" desc:"most bytes of a response body logged"`
+	// ContentTypes are the media types whose bodies are logged, all when empty.
+	// SkipContentTypes are never logged, nor are compressed bodies.
+	ContentTypes     []string `config:"content_types" default:"application/json,application/*+json,application/x-www-form-urlencoded" desc:"media types whose bodies are logged, * matches any characters, all when empty"`
+	SkipContentTypes []string `config:"skip_content_types" default:"multipart/*,application/octet-stream,application/gzip,application/zip,text/event-stream,image/*,audio/*,video/*" desc:"media types whose bodies are never logged"`
+	// Sampling selects the requests and repeated errors logged
+	Sampling LogSamplingRules `config:"sampling"`
+	// Sampler applies Sampling when nil. Set it to a sampler from
+	// WatchLogSampling to change the sampling without a restart.
+	Sampler *LogSampler `config:"-"`
 }
 
-func (w bodyLogWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
-	return w.ResponseWriter.Write(b)
+// RouteBodyLog is the redaction of a route, read from body_log.routes:
+//
+//	routes:
+//	  "POST /login":
+//	    redaction: {keys: [otp]}
+//	  /export:
+//	    override: true
+//	    redaction: {keys: ["*"]}
+type RouteBodyLog struct {
+	// Redaction is added to the global rules
+	Redaction RouteRedactionRules `config:"redaction"`
+	// Override replaces the global rules, defaults included, with Redaction
+	// instead: only the keys, masks and headers it lists are redacted
+	Override bool `config:"override" desc:"replace the global redaction rules instead of adding to them"`
 }
 
-func (w bodyLogWriter) WriteString(s string) (int, error) {
-	w.body.WriteString(s)
-	return w.ResponseWriter.WriteString(s)
+// Check validates the redaction patterns
+func (r *RouteBodyLog) Check() []config.FieldError {
+	var errs []config.FieldError
+	rules := RedactionRules(r.Redaction)
+	for _, fieldErr := range rules.Check() {
+		errs = append(errs, config.FieldError{Key: "redaction." + fieldErr.Key, Message: fieldErr.Message})
+	}
+	return errs
+}
+
+// DefaultBodyLogOptions logs JSON and form bodies up to 64KiB with DefaultRedactionRules
+func DefaultBodyLogOptions() BodyLogOptions {
+	return BodyLogOptions{
+		Redaction:        DefaultRedactionRules(),
+		MaxRequestBody:   65536,
+		MaxResponseBody:  65536,
+		ContentTypes:     []string{"application/json", "application/*+json", "application/x-www-form-urlencoded"},
+		SkipContentTypes: []string{"multipart/*", "application/octet-stream", "application/gzip", "application/zip", "text/event-stream", "image/*", "audio/*", "video/*"},
+		Sampling:         DefaultLogSamplingRules(),
+	}
+}
+
+// Check validates the redaction patterns and sampling rules
+func (o *BodyLogOptions) Check() []config.FieldError {
+	var errs []config.FieldError
+	for _, fieldErr := range o.Redaction.Check() {
+		errs = append(errs, config.FieldError{Key: "redaction." + fieldErr.Key, Message: fieldErr.Message})
+	}
+	for _, fieldErr := range o.Sampling.Check() {
+		errs = append(errs, config.FieldError{Key: "sampling." + fieldErr.Key, Message: fieldErr.Message})
+	}
+	return errs
+}
+
+// LoadBodyLogOptions returns the body_log config, with every invalid key in the error
+func LoadBodyLogOptions() (BodyLogOptions, error) {
+	return config.Load[BodyLogOptions](config.LoadOptions{Prefix: "body_log"})
 }
 
+// LogResponseAndRequestBodyMiddleware is BodyLogMiddleware with DefaultBodyLogOptions
 func LogResponseAndRequestBodyMiddleware(logger *zap.Logger, conf *ginzap.Config) gin.HandlerFunc {
+	return BodyLogMiddleware(logger, conf, DefaultBodyLogOptions())
+}
+
+// BodyLogMiddleware logs every request with its request and response bodies
+// and query string, redacted by opts. Bodies are kept up to the configured
+// sizes and only for the configured content types. Responses the handler
+// flushes, such as server-sent events, are streamed and their body is not
+// logged. Requests and repeated errors are sampled by opts.Sampler.
+func BodyLogMiddleware(logger *zap.Logger, conf *ginzap.Config, opts BodyLogOptions) gin.HandlerFunc {
 	skipPaths := make(map[string]bool, len(conf.SkipPaths))
 	for _, path := range conf.SkipPaths {
 		skipPaths[path] = true
 	}
+	redactor := NewRedactor(opts.Redaction)
+	routeRedactors := make(map[string]*Redactor, len(opts.Routes))
+	for route, rules := range opts.Routes {
+		routeRedactors[strings.ToLower(route)] = NewRedactor(opts.Redaction.merge(rules))
+	}
+	filter := contentTypeFilter{allow: opts.ContentTypes, deny: opts.SkipContentTypes}
+	sampler := opts.Sampler
+	if sampler == nil {
+		sampler = NewLogSampler(opts.Sampling)
+	}
 	return func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
-		query := c.Request.URL.RawQuery
 
 		if _, ok := skipPaths[path]; !ok {
+			r := redactor
+			route := strings.ToLower(c.FullPath())
+			if routeRedactor, ok := routeRedactors[strings.ToLower(c.Request.Method)+" "+route]; ok {
+				r = routeRedactor
+			} else if routeRedactor, ok := routeRedactors[route]; ok {
+				r = routeRedactor
+			}
+			query := r.Query(c.Request.URL.RawQuery)
+
 			var fields []zapcore.Field
-			request, _ := ioutil.ReadAll(c.Request.Body)
-			reqBodyCloser := ioutil.NopCloser(bytes.NewBuffer(request))
-			var requestBody interface{}
-			json.Unmarshal([]byte(request), &requestBody)
-			fields = []zapcore.Field{
-				zap.Any("request-body", requestBody),
+			var request []byte
+			var requestTruncated bool
+			// counts what is read from the client, the capture included
+			requestBody := countRequest(c.Request)
+			if opts.MaxRequestBody > 0 && filter.captures(c.Request.Header) {
+				request, requestTruncated = captureRequest(c.Request, opts.MaxRequestBody)
 			}
-			c.Request.Body = reqBodyCloser
-			blw := &bodyLogWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
-			c.Writer = blw
+			cw := &captureWriter{
+				ResponseWriter: c.Writer,
+				limit:          opts.MaxResponseBody,
+				captures: func(header http.Header) bool {
+					return opts.MaxResponseBody > 0 && filter.captures(header)
+				},
+			}
+			c.Writer = cw
 			c.Next()
-			var responseBody interface{}
-			response, _ := ioutil.ReadAll(blw.body)
-			json.Unmarshal([]byte(response), &responseBody)
-			fields = append(fields, zap.Any("response-body", responseBody))
+			if !sampler.sample(c.Request.Method, c.FullPath(), c.Writer.Status(), len(c.Errors) > 0) {
+				dropped("sampled", max(len(c.Errors), 1))
+				return
+			}
+			fields = append(fields, zap.Any("request-body", redactBody(r, c.ContentType(), request, requestTruncated)))
+			fields = append(fields, zap.Int64("request-body-size", requestBody.read))
+			fields = append(fields, zap.Bool("request-body-truncated", requestTruncated))
+			fields = append(fields, zap.Any("response-body", redactBody(r, cw.Header().Get("Content-Type"), cw.body.Bytes(), cw.truncated)))
+			fields = append(fields, zap.Int64("response-body-size", cw.written))
+			fields = append(fields, zap.Bool("response-body-truncated", cw.truncated))
+			if opts.LogHeaders {
+				fields = append(fields, zap.Any("request-headers", r.Header(c.Request.Header)))
+				fields = append(fields, zap.Any("response-headers", r.Header(cw.Header())))
+			}
 			end := time.Now()
 			latency := end.Sub(start)
 			if conf.UTC {
@@ -66,6 +176,10 @@ func LogResponseAndRequestBodyMiddleware(logger *zap.Logger, conf *ginzap.Config
 			fields = append(fields, zap.String("ip", c.ClientIP()))
 			fields = append(fields, zap.String("user-agent", c.Request.UserAgent()))
 			fields = append(fields, zap.Duration("latency", latency))
+			if id := requestid.FromContext(c); id != "" {
+				fields = append(fields, zap.String("request_id", id))
+			}
+			fields = append(fields, contextFields(c)...)
 
 			if conf.TimeFormat != "" {
 				fields = append(fields, zap.String("time", end.Format(conf.TimeFormat)))
@@ -87,6 +201,15 @@ func LogResponseAndRequestBodyMiddleware(logger *zap.Logger, conf *ginzap.Config
 			if len(c.Errors) > 0 {
 				// Append error field if this is an erroneous request.
 				for _, e := range c.Errors.Errors() {
+					keep, repeats := sampler.repeat(e)
+					if !keep {
+						dropped("deduplicated", 1)
+						continue
+					}
+					if repeats > 0 {
+						logger.Error(e, append(fields, zap.Int("error-repeats", repeats))...)
+						continue
+					}
 					logger.Error(e, fields...)
 				}
 			} else {
@@ -95,3 +218,26 @@ func LogResponseAndRequestBodyMiddleware(logger *zap.Logger, conf *ginzap.Config
 		}
 	}
 }
+
+// redactBody decodes a JSON or form body and redacts it. JSON bodies that are
+// truncated or do not decode are replaced by a marker, as their sensitive
+// values can not be found reliably.
+func redactBody(r *Redactor, contentType string, body []byte, truncated bool) interface{} {
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if truncated {
+			return r.Query(string(body)) + TruncatedMarker
+		}
+		return r.Query(string(body))
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	if truncated {
+		return TruncatedBody
+	}
+	var decoded interface{}
+	if json.Unmarshal(body, &decoded) != nil {
+		return UnparsableBody
+	}
+	return r.Value(decoded)
+}
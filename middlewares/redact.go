@@ -0,0 +1,291 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/robertantonyjaikumar/hangover-common/config"
+)
+
+// RedactedValue replaces redacted values in logs
+const RedactedValue = "[REDACTED]"
+
+// Masks are the built-in patterns RedactionRules.Masks can name
+var Masks = map[string]string{
+	"email": `[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`,
+	"card":  `\b\d(?:[ -]?\d){12,18}\b`,
+	"phone": `(?:\+\d{7,14}\b|(?:\+\d{1,3}[ -]?)?(?:\(\d{2,4}\)|\b\d{2,4})[ -]\d{3,4}[ -]?\d{3,4}\b)`,
+}
+
+// maskChecks confirm the matches of a mask before they are masked, so order
+// numbers and timestamps are not taken for card numbers
+var maskChecks = map[string]func(match string) bool{
+	"card": luhnValid,
+}
+
+// RedactionRules selects what is redacted from logged bodies, query strings
+// and headers
+type RedactionRules struct {
+	// Keys are key names whose values are redacted wherever they appear in a
+	// body or the query string, case insensitive, * matches any characters
+	Keys []string `config:"keys" default:"*password*,passwd,*secret*,*token*,authorization,api_key,apikey" desc:"key names redacted anywhere in bodies and query strings, * matches any characters"`
+	// Paths are dotted paths from the body root, * matches any key or index:
+	// user.ssn, items.*.card
+	Paths []string `config:"paths" desc:"dotted JSON paths redacted from bodies, * matches any key or array index"`
+	// Masks names the built-in patterns masked in every string value
+	Masks []string `config:"masks" default:"email,card,phone" desc:"built-in patterns masked in string values: email, card, phone"`
+	// Patterns are extra regular expressions masked in every string value
+	Patterns []string `config:"patterns" desc:"regular expressions masked in string values"`
+	// Headers are the header names whose values are redacted
+	Headers []string `config:"headers" default:"authorization,proxy-authorization,cookie,set-cookie,x-auth-key" desc:"headers whose values are redacted"`
+}
+
+// Check validates the patterns
+func (r *RedactionRules) Check() []config.FieldError {
+	var errs []config.FieldError
+	for _, mask := range r.Masks {
+		if _, ok := Masks[mask]; !ok {
+			errs = append(errs, config.FieldError{Key: "masks", Message: "unknown mask " + mask})
+		}
+	}
+	for _, pattern := range r.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, config.FieldError{Key: "patterns", Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// DefaultRedactionRules redacts credentials, tokens, emails, card and phone numbers
+func DefaultRedactionRules() RedactionRules {
+	return RedactionRules{
+		Keys:    []string{"*password*", "passwd", "*secret*", "*token*", "authorization", "api_key", "apikey"},
+		Masks:   []string{"email", "card", "phone"},
+		Headers: []string{"authorization", "proxy-authorization", "cookie", "set-cookie", "x-auth-key"},
+	}
+}
+
+// Redactor applies compiled RedactionRules
+type Redactor struct {
+	keys    []*regexp.Regexp
+	paths   [][]*regexp.Regexp
+	masks   []mask
+	headers map[string]bool
+}
+
+// mask is a compiled pattern, its matches are masked when check accepts them
+type mask struct {
+	pattern *regexp.Regexp
+	check   func(match string) bool
+}
+
+// NewRedactor compiles rules, it panics on an invalid pattern
+func NewRedactor(rules RedactionRules) *Redactor {
+	r := &Redactor{headers: map[string]bool{}}
+	for _, key := range rules.Keys {
+		r.keys = append(r.keys, globPattern(key))
+	}
+	for _, path := range rules.Paths {
+		var segments []*regexp.Regexp
+		for _, segment := range strings.Split(strings.TrimPrefix(path, "$."), ".") {
+			segments = append(segments, globPattern(segment))
+		}
+		r.paths = append(r.paths, segments)
+	}
+	for _, name := range rules.Masks {
+		if pattern, ok := Masks[name]; ok {
+			r.masks = append(r.masks, mask{pattern: regexp.MustCompile(pattern), check: maskChecks[name]})
+		}
+	}
+	for _, pattern := range rules.Patterns {
+		r.masks = append(r.masks, mask{pattern: regexp.MustCompile(pattern)})
+	}
+	for _, header := range rules.Headers {
+		r.headers[http.CanonicalHeaderKey(header)] = true
+	}
+	return r
+}
+
+func globPattern(glob string) *regexp.Regexp {
+	return regexp.MustCompile("(?i)^" + strings.ReplaceAll(regexp.QuoteMeta(glob), `\*`, ".*") + "$")
+}
+
+// RouteRedactionRules are the RedactionRules of a route. They have no
+// defaults, a route overriding the global rules gets only the ones it lists.
+type RouteRedactionRules struct {
+	Keys     []string `config:"keys" desc:"key names redacted anywhere in bodies and query strings, * matches any characters"`
+	Paths    []string `config:"paths" desc:"dotted JSON paths redacted from bodies, * matches any key or array index"`
+	Masks    []string `config:"masks" desc:"built-in patterns masked in string values: email, card, phone"`
+	Patterns []string `config:"patterns" desc:"regular expressions masked in string values"`
+	Headers  []string `config:"headers" desc:"headers whose values are redacted"`
+}
+
+// merge returns the rules of route added to r, or alone when they override r
+func (r RedactionRules) merge(route RouteBodyLog) RedactionRules {
+	rules := RedactionRules(route.Redaction)
+	if route.Override {
+		return rules
+	}
+	return RedactionRules{
+		Keys:     union(r.Keys, rules.Keys),
+		Paths:    union(r.Paths, rules.Paths),
+		Masks:    union(r.Masks, rules.Masks),
+		Patterns: union(r.Patterns, rules.Patterns),
+		Headers:  union(r.Headers, rules.Headers),
+	}
+}
+
+// union returns the values of a then those of b not in a
+func union(a, b []string) []string {
+	out := append([]string(nil), a...)
+	seen := make(map[string]bool, len(a))
+	for _, v := range a {
+		seen[v] = true
+	}
+	for _, v := range b {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Value returns a redacted copy of a decoded JSON value
+func (r *Redactor) Value(v interface{}) interface{} {
+	return r.value(v, nil)
+}
+
+func (r *Redactor) value(v interface{}, path []string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			child := append(path[:len(path):len(path)], key)
+			if r.redactsKey(key) || r.redactsPath(child) {
+				out[key] = RedactedValue
+				continue
+			}
+			out[key] = r.value(item, child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = r.value(item, append(path[:len(path):len(path)], strconv.Itoa(i)))
+		}
+		return out
+	case string:
+		return r.mask(v)
+	}
+	return v
+}
+
+// Query returns raw with the values of redacted keys replaced and masks applied
+func (r *Redactor) Query(raw string) string {
+	if raw == "" {
+		return raw
+	}
+	params := strings.Split(raw, "&")
+	for i, param := range params {
+		key, value, _ := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if r.redactsKey(name) || r.redactsPath([]string{name}) {
+			params[i] = key + "=" + RedactedValue
+			continue
+		}
+		if decoded, err := url.QueryUnescape(value); err == nil {
+			if masked := r.mask(decoded); masked != decoded {
+				params[i] = key + "=" + masked
+			}
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// Header returns the values of every header with redacted ones replaced
+func (r *Redactor) Header(header http.Header) map[string]string {
+	out := make(map[string]string, len(header))
+	for name, values := range header {
+		if len(values) == 0 {
+			continue
+		}
+		if r.headers[http.CanonicalHeaderKey(name)] {
+			out[name] = RedactedValue
+			continue
+		}
+		out[name] = r.mask(strings.Join(values, ", "))
+	}
+	return out
+}
+
+func (r *Redactor) redactsKey(key string) bool {
+	for _, pattern := range r.keys {
+		if pattern.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) redactsPath(path []string) bool {
+	for _, segments := range r.paths {
+		if len(segments) != len(path) {
+			continue
+		}
+		matched := true
+		for i, segment := range segments {
+			if !segment.MatchString(path[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) mask(s string) string {
+	for _, m := range r.masks {
+		if m.check == nil {
+			s = m.pattern.ReplaceAllString(s, RedactedValue)
+			continue
+		}
+		s = m.pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if !m.check(match) {
+				return match
+			}
+			return RedactedValue
+		})
+	}
+	return s
+}
+
+// luhnValid reports whether the digits of s pass the Luhn checksum of card numbers
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
@@ -0,0 +1,170 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/robertantonyjaikumar/hangover-common/config"
+	"github.com/spf13/viper"
+)
+
+func TestRedactorValue(t *testing.T) {
+	rules := DefaultRedactionRules()
+	rules.Paths = []string{"user.ssn", "items.*.card"}
+	r := NewRedactor(rules)
+	tests := []struct {
+		name string
+		in   interface{}
+		want interface{}
+	}{
+		{
+			name: "keys at any depth",
+			in:   map[string]interface{}{"Password": "x", "user": map[string]interface{}{"api_token": "y", "name": "Ann"}},
+			want: map[string]interface{}{"Password": RedactedValue, "user": map[string]interface{}{"api_token": RedactedValue, "name": "Ann"}},
+		},
+		{
+			name: "paths",
+			in:   map[string]interface{}{"user": map[string]interface{}{"ssn": "123"}, "ssn": "kept"},
+			want: map[string]interface{}{"user": map[string]interface{}{"ssn": RedactedValue}, "ssn": "kept"},
+		},
+		{
+			name: "array paths",
+			in:   map[string]interface{}{"items": []interface{}{map[string]interface{}{"card": "x", "sku": "a"}}},
+			want: map[string]interface{}{"items": []interface{}{map[string]interface{}{"card": RedactedValue, "sku": "a"}}},
+		},
+		{
+			name: "masks",
+			in:   []interface{}{"mail ann@example.com", "card 4111 1111 1111 1111", 42.0},
+			want: []interface{}{"mail " + RedactedValue, "card " + RedactedValue, 42.0},
+		},
+		{
+			name: "card numbers failing the luhn check",
+			in:   []interface{}{"order 1234567890123456", "card 4111111111111112"},
+			want: []interface{}{"order 1234567890123456", "card 4111111111111112"},
+		},
+		{
+			name: "object under a redacted key",
+			in:   map[string]interface{}{"secret": map[string]interface{}{"a": "b"}},
+			want: map[string]interface{}{"secret": RedactedValue},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Value(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Value = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactorQuery(t *testing.T) {
+	r := NewRedactor(DefaultRedactionRules())
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"page=2&sort=name", "page=2&sort=name"},
+		{"access_token=abc&page=2", "access_token=" + RedactedValue + "&page=2"},
+		{"pass%77ord=abc", "pass%77ord=" + RedactedValue},
+		{"email=ann%40example.com", "email=" + RedactedValue},
+	}
+	for _, tt := range tests {
+		if got := r.Query(tt.in); got != tt.want {
+			t.Errorf("Query(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	r := NewRedactor(DefaultRedactionRules())
+	const form = "application/x-www-form-urlencoded"
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		truncated   bool
+		want        interface{}
+	}{
+		{"empty", "application/json", "", false, nil},
+		{"json", "application/json", `{"token":"abc","id":7}`, false, map[string]interface{}{"token": RedactedValue, "id": 7.0}},
+		{"truncated json", "application/json", `{"secret":{"pin":"12`, true, TruncatedBody},
+		{"invalid json", "application/json", `{"password":`, false, UnparsableBody},
+		{"form", form, "password=x&page=2", false, "password=" + RedactedValue + "&page=2"},
+		{"truncated form", form, "page=2&password=hun", true, "page=2&password=" + RedactedValue + TruncatedMarker},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactBody(r, tt.contentType, []byte(tt.body), tt.truncated); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redactBody = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactorHeader(t *testing.T) {
+	r := NewRedactor(DefaultRedactionRules())
+	got := r.Header(http.Header{
+		"Authorization": {"Bearer abc"},
+		"X-Auth-Key":    {"key"},
+		"Accept":        {"text/html", "application/json"},
+		"X-Empty":       {},
+	})
+	want := map[string]string{
+		"Authorization": RedactedValue,
+		"X-Auth-Key":    RedactedValue,
+		"Accept":        "text/html, application/json",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Header = %v, want %v", got, want)
+	}
+}
+
+func TestRedactionRulesMerge(t *testing.T) {
+	global := RedactionRules{Keys: []string{"password"}, Headers: []string{"cookie"}}
+	added := global.merge(RouteBodyLog{Redaction: RouteRedactionRules{Keys: []string{"pin", "password"}}})
+	if want := []string{"password", "pin"}; !reflect.DeepEqual(added.Keys, want) {
+		t.Errorf("merged keys = %v, want %v", added.Keys, want)
+	}
+	if want := []string{"cookie"}; !reflect.DeepEqual(added.Headers, want) {
+		t.Errorf("merged headers = %v, want %v", added.Headers, want)
+	}
+	override := global.merge(RouteBodyLog{Redaction: RouteRedactionRules{Keys: []string{"pin"}}, Override: true})
+	if want := []string{"pin"}; !reflect.DeepEqual(override.Keys, want) || override.Headers != nil {
+		t.Errorf("override = %+v, want only pin", override)
+	}
+}
+
+func TestLoadBodyLogRoutes(t *testing.T) {
+	v := viper.New()
+	v.Set("body_log.routes", map[string]interface{}{
+		"POST /login": map[string]interface{}{"redaction": map[string]interface{}{"keys": []string{"otp"}}},
+		"/export":     map[string]interface{}{"override": true, "redaction": map[string]interface{}{"keys": []string{"*"}}},
+	})
+	opts, err := config.Load[BodyLogOptions](config.LoadOptions{Prefix: "body_log", Viper: v})
+	if err != nil {
+		t.Fatal(err)
+	}
+	login, ok := opts.Routes["post /login"]
+	if !ok || !reflect.DeepEqual(login.Redaction.Keys, []string{"otp"}) || login.Override {
+		t.Errorf("routes[post /login] = %+v", login)
+	}
+	export := opts.Routes["/export"]
+	if !export.Override || !reflect.DeepEqual(export.Redaction.Keys, []string{"*"}) {
+		t.Errorf("routes[/export] = %+v", export)
+	}
+	rules := opts.Redaction.merge(export)
+	if len(rules.Masks) != 0 || len(rules.Headers) != 0 {
+		t.Errorf("override rules = %+v, want no default masks or headers", rules)
+	}
+
+	v.Set("body_log.routes", map[string]interface{}{
+		"/bad": map[string]interface{}{"redaction": map[string]interface{}{"masks": []string{"ssn"}}},
+	})
+	_, err = config.Load[BodyLogOptions](config.LoadOptions{Prefix: "body_log", Viper: v})
+	var verr *config.ValidationError
+	if !errors.As(err, &verr) || len(verr.Errors) != 1 || verr.Errors[0].Key != "body_log.routes./bad.redaction.masks" {
+		t.Errorf("Load error = %v, want body_log.routes./bad.redaction.masks", err)
+	}
+}
@@ -0,0 +1,199 @@
+package middlewares
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robertantonyjaikumar/hangover-common/config"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"github.com/robertantonyjaikumar/hangover-common/metrics"
+	"go.uber.org/zap"
+)
+
+// maxRepeatedErrors bounds the error messages counted in a period, further
+// messages are logged without deduplication
+const maxRepeatedErrors = 10000
+
+var statusClassKey = regexp.MustCompile(`^[1-5]xx$`)
+
+// LogSamplingRules selects the requests BodyLogMiddleware logs. Requests
+// answered with a 5xx status or with errors are always logged, repeated
+// error messages being deduplicated instead. The rate of other requests is
+// the one of their route when listed, else the one of their status class
+// when listed, else Rate. A rate of 0 logs none.
+//
+//	rate: 0.1
+//	status_classes: {4xx: 1}
+//	routes: {"GET /health": 0}
+type LogSamplingRules struct {
+	// Rate applies when no route or status class rate does, nil logs every request
+	Rate          *float64           `config:"rate" default:"1" validate:"min=0,max=1" desc:"share of requests logged when no route or status class rate applies"`
+	StatusClasses map[string]float64 `config:"status_classes" desc:"share of requests logged by status class such as 2xx"`
+	// Routes are keyed by template as registered, optionally prefixed by the
+	// method: "/users/:id", "POST /login". Keys match case insensitively, viper
+	// lowercases them.
+	Routes map[string]float64 `config:"routes" desc:"share of requests logged by route template, optionally prefixed by the method"`
+	// ErrorsFirst is how many times the same error message is logged each
+	// ErrorsPeriod, then one in ErrorsThereafter is
+	ErrorsFirst      int           `config:"errors_first" validate:"min=0" desc:"times the same error message is logged each period before deduplicating, 0 disables deduplication"`
+	ErrorsThereafter int           `config:"errors_thereafter" default:"100" validate:"min=1" desc:"every how many repeats one is logged once errors_first is reached"`
+	ErrorsPeriod     time.Duration `config:"errors_period" default:"1m" desc:"how long repeats of an error message are counted"`
+}
+
+// DefaultLogSamplingRules logs every request and error
+func DefaultLogSamplingRules() LogSamplingRules {
+	return LogSamplingRules{ErrorsThereafter: 100, ErrorsPeriod: time.Minute}
+}
+
+// Check validates the status classes and rates
+func (r *LogSamplingRules) Check() []config.FieldError {
+	var errs []config.FieldError
+	for class, rate := range r.StatusClasses {
+		if !statusClassKey.MatchString(class) {
+			errs = append(errs, config.FieldError{Key: "status_classes." + class, Message: "must be a status class such as 2xx"})
+		} else if rate < 0 || rate > 1 {
+			errs = append(errs, config.FieldError{Key: "status_classes." + class, Message: "must be between 0 and 1"})
+		}
+	}
+	for route, rate := range r.Routes {
+		if rate < 0 || rate > 1 {
+			errs = append(errs, config.FieldError{Key: "routes." + route, Message: "must be between 0 and 1"})
+		}
+	}
+	if r.ErrorsFirst > 0 && r.ErrorsPeriod <= 0 {
+		errs = append(errs, config.FieldError{Key: "errors_period", Message: "must be positive"})
+	}
+	return errs
+}
+
+// rate returns the share of the requests of route logged with status, 1 for
+// server errors and failed requests. Route keys must be lowercased, see
+// LogSampler.Update.
+func (r *LogSamplingRules) rate(method, route string, status int, failed bool) float64 {
+	if failed || status >= 500 {
+		return 1
+	}
+	route = strings.ToLower(route)
+	if rate, ok := r.Routes[strings.ToLower(method)+" "+route]; ok {
+		return rate
+	}
+	if rate, ok := r.Routes[route]; ok {
+		return rate
+	}
+	if rate, ok := r.StatusClasses[metrics.StatusClass(status)]; ok {
+		return rate
+	}
+	return r.defaultRate()
+}
+
+// defaultRate returns Rate, 1 when unset
+func (r *LogSamplingRules) defaultRate() float64 {
+	if r.Rate == nil {
+		return 1
+	}
+	return *r.Rate
+}
+
+// LogSampler applies LogSamplingRules, which Update replaces at runtime.
+// Dropped lines are counted by metrics.LogLinesDropped.
+type LogSampler struct {
+	rules atomic.Pointer[LogSamplingRules]
+
+	mu      sync.Mutex
+	repeats map[string]int
+	resetAt time.Time
+}
+
+// NewLogSampler returns a sampler applying rules
+func NewLogSampler(rules LogSamplingRules) *LogSampler {
+	s := &LogSampler{}
+	s.Update(rules)
+	return s
+}
+
+// WatchLogSampling returns a sampler applying body_log.sampling of cfg, updated
+// whenever the config files change it. When the section is invalid the
+// sampler logs everything and is not updated.
+func WatchLogSampling(cfg *config.Configuration) (*LogSampler, error) {
+	s := NewLogSampler(DefaultLogSamplingRules())
+	rules, err := config.Subscribe(cfg, config.LoadOptions{Prefix: "body_log.sampling"}, func(_, rules LogSamplingRules) {
+		s.Update(rules)
+		logger.Info("log sampling changed", zap.Float64("rate", rules.defaultRate()), zap.Any("status_classes", rules.StatusClasses), zap.Any("routes", rules.Routes))
+	})
+	if err != nil {
+		return s, err
+	}
+	s.Update(rules)
+	return s, nil
+}
+
+// Update replaces the rules and restarts counting repeated errors
+func (s *LogSampler) Update(rules LogSamplingRules) {
+	if rules.Routes != nil {
+		routes := make(map[string]float64, len(rules.Routes))
+		for route, rate := range rules.Routes {
+			routes[strings.ToLower(route)] = rate
+		}
+		rules.Routes = routes
+	}
+	if rules.ErrorsThereafter < 1 {
+		rules.ErrorsThereafter = 1
+	}
+	if rules.ErrorsPeriod <= 0 {
+		rules.ErrorsPeriod = time.Minute
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules.Store(&rules)
+	s.repeats = nil
+}
+
+// Rules returns the rules applied
+func (s *LogSampler) Rules() LogSamplingRules {
+	return *s.rules.Load()
+}
+
+// sample reports whether a request of route answered with status is logged,
+// failed when its handlers added errors
+func (s *LogSampler) sample(method, route string, status int, failed bool) bool {
+	rate := s.rules.Load().rate(method, route, status, failed)
+	if rate >= 1 {
+		return true
+	}
+	return rate > 0 && rand.Float64() < rate
+}
+
+// repeat reports whether an error message is logged, and how many times it
+// was seen this period once it is being deduplicated
+func (s *LogSampler) repeat(message string) (bool, int) {
+	rules := s.rules.Load()
+	if rules.ErrorsFirst <= 0 {
+		return true, 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.repeats == nil || now.After(s.resetAt) {
+		s.repeats = map[string]int{}
+		s.resetAt = now.Add(rules.ErrorsPeriod)
+	}
+	n, ok := s.repeats[message]
+	if !ok && len(s.repeats) >= maxRepeatedErrors {
+		return true, 0
+	}
+	n++
+	s.repeats[message] = n
+	if n <= rules.ErrorsFirst {
+		return true, 0
+	}
+	return (n-rules.ErrorsFirst)%rules.ErrorsThereafter == 0, n
+}
+
+// dropped counts n log lines dropped for reason
+func dropped(reason string, n int) {
+	metrics.LogLinesDropped.WithLabelValues(reason).Add(float64(n))
+}
@@ -0,0 +1,160 @@
+package middlewares
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robertantonyjaikumar/hangover-common/config"
+	"github.com/spf13/viper"
+)
+
+func rate(r float64) *float64 {
+	return &r
+}
+
+func TestLogSamplingRulesRate(t *testing.T) {
+	rules := NewLogSampler(LogSamplingRules{
+		Rate:          rate(0.5),
+		StatusClasses: map[string]float64{"4xx": 0.1},
+		Routes:        map[string]float64{"/health": 0, "POST /login": 0.25, "/Users/:ID/Avatar": 0.75},
+	}).Rules()
+	tests := []struct {
+		name   string
+		method string
+		route  string
+		status int
+		failed bool
+		want   float64
+	}{
+		{"default rate", "GET", "/users/:id", 200, false, 0.5},
+		{"route", "GET", "/health", 200, false, 0},
+		{"method and route", "POST", "/login", 200, false, 0.25},
+		{"other method of route", "GET", "/login", 200, false, 0.5},
+		{"status class", "GET", "/users/:id", 404, false, 0.1},
+		{"route before status class", "GET", "/health", 404, false, 0},
+		{"server error kept", "GET", "/health", 500, false, 1},
+		{"failed request kept", "GET", "/health", 200, true, 1},
+		{"route case insensitive", "GET", "/users/:id/avatar", 200, false, 0.75},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rules.rate(tt.method, tt.route, tt.status, tt.failed); got != tt.want {
+				t.Errorf("rate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogSamplingRulesCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules LogSamplingRules
+		keys  []string
+	}{
+		{"valid", LogSamplingRules{Rate: rate(1), StatusClasses: map[string]float64{"4xx": 0.5}}, nil},
+		{"status class key", LogSamplingRules{StatusClasses: map[string]float64{"404": 1}}, []string{"status_classes.404"}},
+		{"status class rate", LogSamplingRules{StatusClasses: map[string]float64{"2xx": 2}}, []string{"status_classes.2xx"}},
+		{"route rate", LogSamplingRules{Routes: map[string]float64{"/a": -1}}, []string{"routes./a"}},
+		{"period", LogSamplingRules{ErrorsFirst: 1}, []string{"errors_period"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var keys []string
+			for _, fieldErr := range tt.rules.Check() {
+				keys = append(keys, fieldErr.Key)
+			}
+			if !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("Check keys = %v, want %v", keys, tt.keys)
+			}
+		})
+	}
+}
+
+func TestLogSamplerSample(t *testing.T) {
+	s := NewLogSampler(LogSamplingRules{Routes: map[string]float64{"/health": 0}})
+	for i := 0; i < 100; i++ {
+		if !s.sample("GET", "/users", 200, false) {
+			t.Fatal("unset rate dropped a request")
+		}
+		if s.sample("GET", "/health", 200, false) {
+			t.Fatal("rate 0 logged a request")
+		}
+		if !s.sample("GET", "/health", 503, false) || !s.sample("GET", "/health", 200, true) {
+			t.Fatal("rate 0 dropped a failed request")
+		}
+	}
+}
+
+func TestLogSamplerRepeat(t *testing.T) {
+	s := NewLogSampler(LogSamplingRules{ErrorsFirst: 2, ErrorsThereafter: 3, ErrorsPeriod: time.Minute})
+	want := []struct {
+		logged bool
+		seen   int
+	}{{true, 0}, {true, 0}, {false, 3}, {false, 4}, {true, 5}, {false, 6}}
+	for i, w := range want {
+		logged, seen := s.repeat("boom")
+		if logged != w.logged || seen != w.seen {
+			t.Errorf("repeat #%d = %v %d, want %v %d", i+1, logged, seen, w.logged, w.seen)
+		}
+	}
+	if logged, _ := s.repeat("other"); !logged {
+		t.Error("first occurrence of another message dropped")
+	}
+
+	s.Update(s.Rules())
+	if logged, seen := s.repeat("boom"); !logged || seen != 0 {
+		t.Errorf("repeat after Update = %v %d, want counting restarted", logged, seen)
+	}
+}
+
+func TestLogSamplerRepeatDisabled(t *testing.T) {
+	s := NewLogSampler(DefaultLogSamplingRules())
+	for i := 0; i < 5; i++ {
+		if logged, _ := s.repeat("boom"); !logged {
+			t.Fatal("error dropped without deduplication")
+		}
+	}
+}
+
+func TestLogSamplerZeroRate(t *testing.T) {
+	s := NewLogSampler(LogSamplingRules{Rate: rate(0)})
+	for i := 0; i < 100; i++ {
+		if s.sample("GET", "/users", 200, false) {
+			t.Fatal("rate 0 logged a request")
+		}
+	}
+}
+
+func TestLoadLogSamplingRules(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(`
+body_log:
+  sampling:
+    routes:
+      "POST /Login": 0
+`)); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := config.Load[LogSamplingRules](config.LoadOptions{Prefix: "body_log.sampling", Viper: v})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules.Rate == nil || *rules.Rate != 1 {
+		t.Errorf("Rate = %v, want the default 1", rules.Rate)
+	}
+	s := NewLogSampler(rules)
+	if s.sample("POST", "/Login", 200, false) {
+		t.Error("route rate 0 logged a request")
+	}
+
+	v.Set("body_log.sampling.rate", 0)
+	if rules, err = config.Load[LogSamplingRules](config.LoadOptions{Prefix: "body_log.sampling", Viper: v}); err != nil {
+		t.Fatal(err)
+	}
+	if rules.Rate == nil || *rules.Rate != 0 {
+		t.Errorf("Rate = %v, want 0", rules.Rate)
+	}
+}
@@ -1,20 +1,18 @@
 package middlewares
 
-import "time"
+import (
+	"time"
+
+	"github.com/robertantonyjaikumar/hangover-common/claims"
+)
 
 type Token struct {
 	Value  string    `json:"value"  binding:"required"`
 	Expiry time.Time `json:"expiry" binding:"required"`
 }
 
-type JwtAuthPayload struct {
-	TID  string `json:"tid"  binding:"required"`
-	Type string `json:"type" binding:"required"`
-}
+// Deprecated: use claims.Auth
+type JwtAuthPayload = claims.Auth
 
-type JwtSessionPayload struct {
-	TID  string `json:"tid"  binding:"required"`
-	Type string `json:"type" binding:"required"`
-	RID  string `json:"rid"  binding:"required"`
-	SID  string `json:"sid"  binding:"required"`
-}
+// Deprecated: use claims.Session
+type JwtSessionPayload = claims.Session
@@ -0,0 +1,94 @@
+// Package requestid carries the ID of a request through contexts, outgoing
+// HTTP calls and SQL comments so every log line of a request can be
+// correlated.
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// Header carries the request ID on incoming and outgoing HTTP requests
+	Header = "X-Request-ID"
+	// GinKey is the gin context key the request ID is stored under
+	GinKey = "x-request-id"
+
+	maxLength = 128
+)
+
+type ctxKey struct{}
+
+// New returns a new request ID
+func New() string {
+	return uuid.NewString()
+}
+
+// Valid reports whether id can be accepted from a client: at most 128
+// letters, digits, dots, dashes, underscores and colons
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '-', r == '_', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// WithContext returns a copy of ctx carrying id
+func WithContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, or by a *gin.Context, or ""
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if id, ok := ctx.Value(ctxKey{}).(string); ok {
+		return id
+	}
+	id, _ := ctx.Value(GinKey).(string)
+	return id
+}
+
+// Transport sets the Header of outgoing requests to the request ID of their
+// context, unless already set
+type Transport struct {
+	// Base defaults to http.DefaultTransport
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	id := FromContext(req.Context())
+	if id == "" || req.Header.Get(Header) != "" {
+		return base.RoundTrip(req)
+	}
+	// a RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set(Header, id)
+	return base.RoundTrip(req)
+}
+
+// NewClient returns an *http.Client propagating request IDs, wrapping the
+// transport of client or http.DefaultTransport when client is nil
+func NewClient(client *http.Client) *http.Client {
+	if client == nil {
+		return &http.Client{Transport: &Transport{}}
+	}
+	wrapped := *client
+	wrapped.Transport = &Transport{Base: client.Transport}
+	return &wrapped
+}
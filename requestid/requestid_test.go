@@ -0,0 +1,108 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"", false},
+		{"0b5c1d2e-7f", true},
+		{"svc.orders:req_1", true},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+		{"with space", false},
+		{"line\nbreak", false},
+		{"quote'", false},
+		{"*/ DROP", false},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.id); got != tt.valid {
+			t.Errorf("Valid(%q) = %v, want %v", tt.id, got, tt.valid)
+		}
+	}
+	if id := New(); !Valid(id) {
+		t.Errorf("New() = %q, not valid", id)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set(GinKey, "from-gin")
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"nil", nil, ""},
+		{"none", context.Background(), ""},
+		{"context", WithContext(context.Background(), "from-context"), "from-context"},
+		{"gin", c, "from-gin"},
+	}
+	for _, tt := range tests {
+		if got := FromContext(tt.ctx); got != tt.want {
+			t.Errorf("%s: FromContext = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(Header)
+	}))
+	defer server.Close()
+	client := NewClient(nil)
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		header string
+		want   string
+	}{
+		{name: "no request id", ctx: context.Background()},
+		{name: "propagated", ctx: WithContext(context.Background(), "req-1"), want: "req-1"},
+		{name: "header kept", ctx: WithContext(context.Background(), "req-1"), header: "set-by-caller", want: "set-by-caller"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequestWithContext(tt.ctx, http.MethodGet, server.URL, nil)
+			if tt.header != "" {
+				req.Header.Set(Header, tt.header)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if received != tt.want {
+				t.Errorf("server received %q, want %q", received, tt.want)
+			}
+			if got := req.Header.Get(Header); got != tt.header {
+				t.Errorf("caller request header = %q, want it unchanged", got)
+			}
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	base := &http.Client{Transport: http.DefaultTransport, Timeout: 5}
+	wrapped := NewClient(base)
+	transport, ok := wrapped.Transport.(*Transport)
+	if !ok || transport.Base != http.DefaultTransport || wrapped.Timeout != base.Timeout {
+		t.Errorf("NewClient = %+v, want the client with a wrapping Transport", wrapped)
+	}
+	if base.Transport != http.DefaultTransport {
+		t.Error("NewClient changed the client passed")
+	}
+}
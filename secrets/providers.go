@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/subosito/gotenv"
+)
+
+// FileProvider reads KEY=value env files such as the ones the vault agent
+// renders into /vault/secrets. The path of secret://vault/db#db_password is
+// the file name without the extension.
+type FileProvider struct {
+	Dir string
+	// Ext is appended to the path, defaults to .env
+	Ext string
+}
+
+func (p FileProvider) Fetch(ctx context.Context, path string) (Values, error) {
+	ext := p.Ext
+	if ext == "" {
+		ext = ".env"
+	}
+	env, err := gotenv.Read(filepath.Join(p.Dir, filepath.Clean("/"+path)+ext))
+	if err != nil {
+		return Values{}, err
+	}
+	return Values{Data: env}, nil
+}
+
+// EnvProvider reads environment variables, secret://env#DB_PASSWORD reads
+// DB_PASSWORD. A path is used as a prefix, secret://env/reporting#DB_PASSWORD
+// reads REPORTING_DB_PASSWORD.
+type EnvProvider struct{}
+
+func (EnvProvider) Fetch(ctx context.Context, path string) (Values, error) {
+	prefix := ""
+	if path != "" {
+		prefix = strings.ToUpper(path) + "_"
+	}
+	data := map[string]string{}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, prefix) {
+			data[strings.TrimPrefix(name, prefix)] = value
+		}
+	}
+	return Values{Data: data}, nil
+}
+
+// DirProvider reads a directory holding one file per key, the layout of a
+// mounted kubernetes secret. secret://k8s/db#password reads <Dir>/db/password.
+type DirProvider struct {
+	Dir string
+}
+
+func (p DirProvider) Fetch(ctx context.Context, path string) (Values, error) {
+	dir := filepath.Join(p.Dir, filepath.Clean("/"+path))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return Values{}, err
+	}
+	data := map[string]string{}
+	for _, entry := range entries {
+		// kubernetes mounts keep the real files in ..data, the keys are symlinks
+		if strings.HasPrefix(entry.Name(), "..") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		data[entry.Name()] = strings.TrimSuffix(string(content), "\n")
+	}
+	return Values{Data: data}, nil
+}
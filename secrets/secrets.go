@@ -0,0 +1,245 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// RefPrefix starts a secret reference: secret://<provider>/<path>#<key>
+const RefPrefix = "secret://"
+
+const masked = "******"
+
+// Secret is a secret value that never prints, logs or marshals itself
+type Secret string
+
+func (s Secret) String() string {
+	return masked
+}
+
+func (s Secret) GoString() string {
+	return masked
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + masked + `"`), nil
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(masked), nil
+}
+
+// Reveal returns the secret value
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// Values are the keys of one secret as returned by a Provider
+type Values struct {
+	Data map[string]string
+	// TTL is how long the values may be cached, zero uses the Resolver default
+	TTL time.Duration
+	// LeaseID and Renewable describe a lease a Renewer can extend
+	LeaseID   string
+	Renewable bool
+}
+
+// Provider fetches the secret stored at path
+type Provider interface {
+	Fetch(ctx context.Context, path string) (Values, error)
+}
+
+// Renewer is implemented by providers whose secrets carry renewable leases
+type Renewer interface {
+	// Renew extends the lease and returns its new TTL
+	Renew(ctx context.Context, leaseID string) (time.Duration, error)
+}
+
+// Ref is a parsed secret://<provider>/<path>#<key> reference
+type Ref struct {
+	Provider string
+	Path     string
+	Key      string
+}
+
+// IsRef reports whether value is a secret reference
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, RefPrefix)
+}
+
+// ParseRef parses a secret://<provider>/<path>#<key> reference
+func ParseRef(value string) (Ref, error) {
+	if !IsRef(value) {
+		return Ref{}, fmt.Errorf("secrets: %q is not a secret reference", value)
+	}
+	rest, key, _ := strings.Cut(strings.TrimPrefix(value, RefPrefix), "#")
+	provider, path, _ := strings.Cut(rest, "/")
+	if provider == "" || key == "" {
+		return Ref{}, fmt.Errorf("secrets: reference %q needs a provider and a #key", value)
+	}
+	return Ref{Provider: provider, Path: path, Key: key}, nil
+}
+
+func (r Ref) String() string {
+	return RefPrefix + r.Provider + "/" + r.Path + "#" + r.Key
+}
+
+// Resolver resolves references against named providers and caches the
+// results. Providers are called without holding its lock, concurrent lookups
+// of the same secret share one call.
+type Resolver struct {
+	// DefaultTTL caches values whose provider gives no TTL, zero caches them until Invalidate
+	DefaultTTL time.Duration
+
+	mu        sync.Mutex
+	providers map[string]Provider
+	cache     map[string]*cached
+	fetches   singleflight.Group
+}
+
+type cached struct {
+	provider string
+	values   Values
+	expires  time.Time
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{
+		DefaultTTL: 5 * time.Minute,
+		providers:  map[string]Provider{},
+		cache:      map[string]*cached{},
+	}
+}
+
+// Register makes provider available to references as secret://<name>/...
+func (r *Resolver) Register(name string, provider Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[name] = provider
+}
+
+// Resolve returns the secret a reference points at
+func (r *Resolver) Resolve(ctx context.Context, value string) (Secret, error) {
+	ref, err := ParseRef(value)
+	if err != nil {
+		return "", err
+	}
+	values, err := r.fetch(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	secret, ok := values.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("secrets: %s has no key %q", ref.Provider+"/"+ref.Path, ref.Key)
+	}
+	return Secret(secret), nil
+}
+
+// Invalidate drops every cached secret
+func (r *Resolver) Invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = map[string]*cached{}
+}
+
+func (r *Resolver) fetch(ctx context.Context, ref Ref) (Values, error) {
+	cacheKey := ref.Provider + "/" + ref.Path
+	r.mu.Lock()
+	if entry, ok := r.cache[cacheKey]; ok && (entry.expires.IsZero() || time.Now().Before(entry.expires)) {
+		r.mu.Unlock()
+		return entry.values, nil
+	}
+	provider, ok := r.providers[ref.Provider]
+	r.mu.Unlock()
+	if !ok {
+		return Values{}, fmt.Errorf("secrets: no provider named %q", ref.Provider)
+	}
+
+	fetched, err, _ := r.fetches.Do(cacheKey, func() (interface{}, error) {
+		values, err := provider.Fetch(ctx, ref.Path)
+		if err != nil {
+			logger.Error("could not fetch secret", zap.String("provider", ref.Provider), zap.String("path", ref.Path), zap.Error(err))
+			return Values{}, err
+		}
+		r.mu.Lock()
+		r.cache[cacheKey] = &cached{provider: ref.Provider, values: values, expires: r.expiry(values.TTL)}
+		r.mu.Unlock()
+		return values, nil
+	})
+	return fetched.(Values), err
+}
+
+func (r *Resolver) expiry(ttl time.Duration) time.Time {
+	if ttl == 0 {
+		ttl = r.DefaultTTL
+	}
+	if ttl == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// RenewLeases renews every cached lease within a third of its TTL of expiring.
+// Leases that cannot be renewed are dropped so the next Resolve fetches them
+// again. Only providers implementing Renewer hand out leases, none of the
+// built-in ones do: their values are fetched again once their TTL expires.
+func (r *Resolver) RenewLeases(ctx context.Context) {
+	type lease struct {
+		cacheKey string
+		entry    *cached
+		renewer  Renewer
+	}
+	var due []lease
+	r.mu.Lock()
+	for cacheKey, entry := range r.cache {
+		if !entry.values.Renewable || entry.values.LeaseID == "" || entry.expires.IsZero() {
+			continue
+		}
+		if time.Until(entry.expires) > entry.values.TTL/3 {
+			continue
+		}
+		if renewer, ok := r.providers[entry.provider].(Renewer); ok {
+			due = append(due, lease{cacheKey: cacheKey, entry: entry, renewer: renewer})
+		}
+	}
+	r.mu.Unlock()
+
+	for _, l := range due {
+		ttl, err := l.renewer.Renew(ctx, l.entry.values.LeaseID)
+		r.mu.Lock()
+		// skip entries fetched again or invalidated meanwhile
+		if r.cache[l.cacheKey] == l.entry {
+			if err != nil {
+				logger.Error("could not renew secret lease", zap.String("secret", l.cacheKey), zap.Error(err))
+				delete(r.cache, l.cacheKey)
+			} else {
+				l.entry.values.TTL = ttl
+				l.entry.expires = r.expiry(ttl)
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+// StartRenewal runs RenewLeases every interval until ctx is done
+func (r *Resolver) StartRenewal(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.RenewLeases(ctx)
+			}
+		}
+	}()
+}
@@ -0,0 +1,159 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProvider returns values for every path, blocking the paths in block
+// until release is closed
+type fakeProvider struct {
+	values  Values
+	block   map[string]bool
+	release chan struct{}
+	fetches atomic.Int32
+
+	renewTTL time.Duration
+	renewErr error
+	renews   atomic.Int32
+}
+
+func (p *fakeProvider) Fetch(ctx context.Context, path string) (Values, error) {
+	p.fetches.Add(1)
+	if p.block[path] {
+		<-p.release
+	}
+	values := p.values
+	values.Data = map[string]string{"key": path}
+	return values, nil
+}
+
+func (p *fakeProvider) Renew(ctx context.Context, leaseID string) (time.Duration, error) {
+	p.renews.Add(1)
+	return p.renewTTL, p.renewErr
+}
+
+func TestResolverDoesNotBlockOtherSecrets(t *testing.T) {
+	provider := &fakeProvider{block: map[string]bool{"slow": true}, release: make(chan struct{})}
+	r := NewResolver()
+	r.Register("fake", provider)
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := r.Resolve(context.Background(), "secret://fake/slow#key")
+		slow <- err
+	}()
+
+	done := make(chan Secret, 1)
+	go func() {
+		secret, _ := r.Resolve(context.Background(), "secret://fake/fast#key")
+		done <- secret
+	}()
+	select {
+	case secret := <-done:
+		if secret.Reveal() != "fast" {
+			t.Errorf("Resolve = %q, want fast", secret.Reveal())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Resolve blocked behind a slow provider call")
+	}
+	close(provider.release)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolverSharesFetches(t *testing.T) {
+	provider := &fakeProvider{block: map[string]bool{"db": true}, release: make(chan struct{})}
+	r := NewResolver()
+	r.Register("fake", provider)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if secret, err := r.Resolve(context.Background(), "secret://fake/db#key"); err != nil || secret.Reveal() != "db" {
+				t.Errorf("Resolve = %q, %v", secret.Reveal(), err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(provider.release)
+	wg.Wait()
+	if got := provider.fetches.Load(); got != 1 {
+		t.Errorf("fetches = %d, want 1", got)
+	}
+}
+
+func TestResolverCache(t *testing.T) {
+	tests := []struct {
+		name       string
+		defaultTTL time.Duration
+		ttl        time.Duration
+		wait       time.Duration
+		fetches    int32
+	}{
+		{name: "cached until invalidated", fetches: 1},
+		{name: "within default ttl", defaultTTL: time.Minute, fetches: 1},
+		{name: "default ttl expired", defaultTTL: 10 * time.Millisecond, wait: 20 * time.Millisecond, fetches: 2},
+		{name: "provider ttl expired", defaultTTL: time.Minute, ttl: 10 * time.Millisecond, wait: 20 * time.Millisecond, fetches: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fakeProvider{values: Values{TTL: tt.ttl}}
+			r := NewResolver()
+			r.DefaultTTL = tt.defaultTTL
+			r.Register("fake", provider)
+			for i := 0; i < 2; i++ {
+				if _, err := r.Resolve(context.Background(), "secret://fake/db#key"); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(tt.wait)
+			}
+			if got := provider.fetches.Load(); got != tt.fetches {
+				t.Errorf("fetches = %d, want %d", got, tt.fetches)
+			}
+		})
+	}
+}
+
+func TestRenewLeases(t *testing.T) {
+	tests := []struct {
+		name      string
+		values    Values
+		renewErr  error
+		renews    int32
+		refetched bool
+	}{
+		{name: "no lease", values: Values{TTL: 30 * time.Millisecond}},
+		{name: "renewed", values: Values{TTL: 30 * time.Millisecond, LeaseID: "lease", Renewable: true}, renews: 1},
+		{name: "renewal failed", values: Values{TTL: 30 * time.Millisecond, LeaseID: "lease", Renewable: true}, renewErr: errors.New("revoked"), renews: 1, refetched: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fakeProvider{values: tt.values, renewTTL: time.Hour, renewErr: tt.renewErr}
+			r := NewResolver()
+			r.Register("fake", provider)
+			if _, err := r.Resolve(context.Background(), "secret://fake/db#key"); err != nil {
+				t.Fatal(err)
+			}
+			// within a third of the ttl of expiring
+			time.Sleep(25 * time.Millisecond)
+			r.RenewLeases(context.Background())
+			if got := provider.renews.Load(); got != tt.renews {
+				t.Errorf("renews = %d, want %d", got, tt.renews)
+			}
+			if _, err := r.Resolve(context.Background(), "secret://fake/db#key"); err != nil {
+				t.Fatal(err)
+			}
+			if refetched := provider.fetches.Load() > 1; refetched != tt.refetched {
+				t.Errorf("fetched again = %v, want %v", refetched, tt.refetched)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// VaultKVProvider reads secrets over HTTP from a Vault KV version 2 engine.
+// secret://kv/app/db#password reads key password of <Mount>/data/app/db.
+// KV reads carry no lease, values are fetched again once the DefaultTTL of
+// the Resolver expires.
+type VaultKVProvider struct {
+	Address string
+	// Mount is the KV engine mount, defaults to secret
+	Mount     string
+	Namespace string
+	// Token authenticates the requests. When empty it is read from TokenFile,
+	// then from the VAULT_TOKEN env var.
+	Token     string
+	TokenFile string
+	Client    *http.Client
+}
+
+type vaultResponse struct {
+	LeaseID       string `json:"lease_id"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+	Data          struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+func (p VaultKVProvider) Fetch(ctx context.Context, path string) (Values, error) {
+	mount := p.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	var body vaultResponse
+	err := p.do(ctx, http.MethodGet, "/v1/"+strings.Trim(mount, "/")+"/data/"+strings.TrimPrefix(path, "/"), nil, &body)
+	if err != nil {
+		return Values{}, err
+	}
+	data := make(map[string]string, len(body.Data.Data))
+	for key, value := range body.Data.Data {
+		data[key] = fmt.Sprint(value)
+	}
+	return Values{
+		Data:      data,
+		TTL:       time.Duration(body.LeaseDuration) * time.Second,
+		LeaseID:   body.LeaseID,
+		Renewable: body.Renewable,
+	}, nil
+}
+
+func (p VaultKVProvider) do(ctx context.Context, method, path string, payload interface{}, out *vaultResponse) error {
+	var reader io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(p.Address, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	token, err := p.token()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if p.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && resp.StatusCode < 300 {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		// vault error messages never contain secret data
+		return fmt.Errorf("vault %s %s: %s %s", method, path, resp.Status, strings.Join(out.Errors, "; "))
+	}
+	return nil
+}
+
+func (p VaultKVProvider) token() (string, error) {
+	if p.Token != "" {
+		return p.Token, nil
+	}
+	if p.TokenFile != "" {
+		token, err := os.ReadFile(p.TokenFile)
+		return strings.TrimSpace(string(token)), err
+	}
+	return os.Getenv("VAULT_TOKEN"), nil
+}
@@ -0,0 +1,13 @@
+package structs
+
+import "net/http"
+
+// IdempotencyRecord is the stored outcome of a request sent with an Idempotency-Key
+type IdempotencyRecord struct {
+	Fingerprint string
+	Completed   bool
+	Status      int
+	ContentType string
+	Headers     http.Header
+	Body        []byte
+}
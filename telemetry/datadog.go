@@ -0,0 +1,127 @@
+package telemetry
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/robertantonyjaikumar/hangover-common/config"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"go.uber.org/zap"
+	sqltrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql"
+	gintrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/gin-gonic/gin"
+	gormtrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/gorm.io/gorm.v1"
+	ddhttp "gopkg.in/DataDog/dd-trace-go.v1/contrib/net/http"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gorm.io/gorm"
+)
+
+// datadogHookOnce adds the Datadog span IDs to the context loggers once, the
+// tracer being global
+var datadogHookOnce sync.Once
+
+// datadogBackend traces with the global Datadog tracer and the dd-trace-go
+// contribs. Tests can replace the tracer with mocktracer.Start.
+type datadogBackend struct {
+	registerOnce sync.Once
+}
+
+func (d *datadogBackend) Name() string {
+	return Datadog
+}
+
+// Start starts the tracer when cfg enables it
+func (d *datadogBackend) Start(cfg config.TracingConfig) error {
+	d.addLogFields()
+	if !cfg.Enabled {
+		return nil
+	}
+	opts := []tracer.StartOption{tracer.WithSampler(tracer.NewRateSampler(cfg.SampleRate))}
+	if cfg.Service != "" {
+		opts = append(opts, tracer.WithService(cfg.Service))
+	}
+	if cfg.Env != "" {
+		opts = append(opts, tracer.WithEnv(cfg.Env))
+	}
+	if cfg.Version != "" {
+		opts = append(opts, tracer.WithServiceVersion(cfg.Version))
+	}
+	if cfg.AgentAddr != "" {
+		opts = append(opts, tracer.WithAgentAddr(cfg.AgentAddr))
+	}
+	if cfg.RuntimeMetrics {
+		opts = append(opts, tracer.WithRuntimeMetrics())
+	}
+	for k, v := range cfg.Tags {
+		opts = append(opts, tracer.WithGlobalTag(k, v))
+	}
+	tracer.Start(opts...)
+	logger.Info("tracer started", zap.String("backend", Datadog), zap.String("service", cfg.Service), zap.String("env", cfg.Env), zap.String("version", cfg.Version))
+	return nil
+}
+
+func (d *datadogBackend) Flush(context.Context) error {
+	tracer.Flush()
+	return nil
+}
+
+func (d *datadogBackend) Shutdown(context.Context) error {
+	tracer.Stop()
+	return nil
+}
+
+func (d *datadogBackend) Middleware(service string) gin.HandlerFunc {
+	d.addLogFields()
+	return gintrace.Middleware(service)
+}
+
+func (d *datadogBackend) Transport(base http.RoundTripper) http.RoundTripper {
+	return ddhttp.WrapRoundTripper(base)
+}
+
+// OpenDB registers the traced pgx driver on first use so the pools of the
+// sources and replicas share it
+func (d *datadogBackend) OpenDB(dsn string) (*sql.DB, error) {
+	d.registerOnce.Do(func() {
+		sqltrace.Register(
+			"pgx",
+			&stdlib.Driver{},
+			sqltrace.WithServiceName(config.Default().GetServiceName()),
+		)
+	})
+	return sqltrace.Open("pgx", dsn)
+}
+
+func (d *datadogBackend) GormPlugin() gorm.Plugin {
+	return gormtrace.NewTracePlugin()
+}
+
+func (d *datadogBackend) StartSpan(ctx context.Context, operation string) (context.Context, func(err error)) {
+	span, ctx := tracer.StartSpanFromContext(ctx, operation)
+	return ctx, func(err error) {
+		span.Finish(tracer.WithError(err))
+	}
+}
+
+// LogFields returns the dd.trace_id and dd.span_id of the span active in ctx
+func (d *datadogBackend) LogFields(ctx context.Context) []zap.Field {
+	span, ok := tracer.SpanFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return []zap.Field{
+		zap.String("dd.trace_id", strconv.FormatUint(span.Context().TraceID(), 10)),
+		zap.String("dd.span_id", strconv.FormatUint(span.Context().SpanID(), 10)),
+	}
+}
+
+// addLogFields adds LogFields to the context loggers
+func (d *datadogBackend) addLogFields() {
+	datadogHookOnce.Do(func() {
+		logger.AddContextFields(d.LogFields)
+	})
+}
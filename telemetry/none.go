@@ -0,0 +1,44 @@
+package telemetry
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/robertantonyjaikumar/hangover-common/config"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// noneBackend traces nothing
+type noneBackend struct{}
+
+func (noneBackend) Name() string                                       { return None }
+func (noneBackend) Start(config.TracingConfig) error                   { return nil }
+func (noneBackend) Flush(context.Context) error                        { return nil }
+func (noneBackend) Shutdown(context.Context) error                     { return nil }
+func (noneBackend) LogFields(context.Context) []zap.Field              { return nil }
+func (noneBackend) Transport(base http.RoundTripper) http.RoundTripper { return base }
+func (noneBackend) GormPlugin() gorm.Plugin                            { return noopPlugin{} }
+
+func (noneBackend) Middleware(string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+	}
+}
+
+func (noneBackend) OpenDB(dsn string) (*sql.DB, error) {
+	return sql.Open("pgx", dsn)
+}
+
+func (noneBackend) StartSpan(ctx context.Context, _ string) (context.Context, func(err error)) {
+	return ctx, func(error) {}
+}
+
+// noopPlugin is the gorm plugin of the none backend
+type noopPlugin struct{}
+
+func (noopPlugin) Name() string              { return "hangover:telemetry_none" }
+func (noopPlugin) Initialize(*gorm.DB) error { return nil }
@@ -0,0 +1,283 @@
+package telemetry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robertantonyjaikumar/hangover-common/config"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// instrumentation is the name of the tracers of this module
+const instrumentation = "github.com/robertantonyjaikumar/hangover-common/telemetry"
+
+// otelBackend traces with the global OpenTelemetry tracer provider, set by
+// Start. Spans created before Start go to the no-op provider.
+type otelBackend struct {
+	mu       sync.Mutex
+	provider *sdktrace.TracerProvider
+	hookOnce sync.Once
+}
+
+func (o *otelBackend) Name() string {
+	return OTel
+}
+
+func (o *otelBackend) tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Start sets the global tracer provider and propagator when cfg enables it
+func (o *otelBackend) Start(cfg config.TracingConfig) error {
+	o.addLogFields()
+	if !cfg.Enabled {
+		return nil
+	}
+	exporter, err := newExporter(cfg.OTLP)
+	if err != nil {
+		return fmt.Errorf("telemetry: %w", err)
+	}
+	attrs := []attribute.KeyValue{semconv.ServiceName(cfg.Service)}
+	if cfg.Env != "" {
+		attrs = append(attrs, semconv.DeploymentEnvironment(cfg.Env))
+	}
+	if cfg.Version != "" {
+		attrs = append(attrs, semconv.ServiceVersion(cfg.Version))
+	}
+	for k, v := range cfg.Tags {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, attrs...))
+	if err != nil {
+		return fmt.Errorf("telemetry: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRate))),
+	)
+
+	o.mu.Lock()
+	o.provider = provider
+	o.mu.Unlock()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	logger.Info("tracer started", zap.String("backend", OTel), zap.String("exporter", cfg.OTLP.Exporter), zap.String("service", cfg.Service), zap.String("env", cfg.Env), zap.String("version", cfg.Version))
+	return nil
+}
+
+// newExporter returns the OTLP/HTTP exporter of cfg, or a stdout exporter
+func newExporter(cfg config.OTLPConfig) (sdktrace.SpanExporter, error) {
+	if cfg.Exporter == "stdout" {
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+	}
+	return otlptracehttp.New(context.Background(), opts...)
+}
+
+func (o *otelBackend) Flush(ctx context.Context) error {
+	o.mu.Lock()
+	provider := o.provider
+	o.mu.Unlock()
+	if provider == nil {
+		return nil
+	}
+	return provider.ForceFlush(ctx)
+}
+
+func (o *otelBackend) Shutdown(ctx context.Context) error {
+	o.mu.Lock()
+	provider := o.provider
+	o.provider = nil
+	o.mu.Unlock()
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
+
+// Middleware continues the trace of the incoming headers with a server span
+// named after the route template. The service name is set on the resource.
+func (o *otelBackend) Middleware(string) gin.HandlerFunc {
+	o.addLogFields()
+	return func(c *gin.Context) {
+		r := c.Request
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		route := c.FullPath()
+		name := r.Method
+		if route != "" {
+			name += " " + route
+		}
+		ctx, span := o.tracer().Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				semconv.ServerAddress(r.Host),
+				semconv.UserAgentOriginal(r.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		c.Request = r.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		if err := c.Errors.Last(); err != nil {
+			span.RecordError(err.Err)
+		}
+	}
+}
+
+func (o *otelBackend) Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
+
+// OpenDB opens a plain pgx pool, the statements are traced by GormPlugin and
+// StartSpan
+func (o *otelBackend) OpenDB(dsn string) (*sql.DB, error) {
+	return sql.Open("pgx", dsn)
+}
+
+func (o *otelBackend) GormPlugin() gorm.Plugin {
+	return &otelGormPlugin{backend: o}
+}
+
+func (o *otelBackend) StartSpan(ctx context.Context, operation string) (context.Context, func(err error)) {
+	ctx, span := o.tracer().Start(ctx, operation)
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// LogFields returns the trace_id and span_id of the span active in ctx, in hex
+func (o *otelBackend) LogFields(ctx context.Context) []zap.Field {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []zap.Field{
+		zap.String("trace_id", sc.TraceID().String()),
+		zap.String("span_id", sc.SpanID().String()),
+	}
+}
+
+// addLogFields adds LogFields to the context loggers
+func (o *otelBackend) addLogFields() {
+	o.hookOnce.Do(func() {
+		logger.AddContextFields(o.LogFields)
+	})
+}
+
+// otelSpanKey is the gorm instance key of the span of a statement
+const otelSpanKey = "telemetry:span"
+
+// otelGormPlugin traces every gorm statement as a client span
+type otelGormPlugin struct {
+	backend *otelBackend
+}
+
+func (p *otelGormPlugin) Name() string {
+	return "hangover:telemetry_otel"
+}
+
+func (p *otelGormPlugin) Initialize(db *gorm.DB) error {
+	callbacks := []error{
+		db.Callback().Create().Before("gorm:create").Register("telemetry:before_create", p.before("INSERT")),
+		db.Callback().Create().After("gorm:create").Register("telemetry:after_create", p.after),
+		db.Callback().Query().Before("gorm:query").Register("telemetry:before_query", p.before("SELECT")),
+		db.Callback().Query().After("gorm:query").Register("telemetry:after_query", p.after),
+		db.Callback().Update().Before("gorm:update").Register("telemetry:before_update", p.before("UPDATE")),
+		db.Callback().Update().After("gorm:update").Register("telemetry:after_update", p.after),
+		db.Callback().Delete().Before("gorm:delete").Register("telemetry:before_delete", p.before("DELETE")),
+		db.Callback().Delete().After("gorm:delete").Register("telemetry:after_delete", p.after),
+		db.Callback().Row().Before("gorm:row").Register("telemetry:before_row", p.before("SELECT")),
+		db.Callback().Row().After("gorm:row").Register("telemetry:after_row", p.after),
+		db.Callback().Raw().Before("gorm:raw").Register("telemetry:before_raw", p.before("RAW")),
+		db.Callback().Raw().After("gorm:raw").Register("telemetry:after_raw", p.after),
+	}
+	for _, err := range callbacks {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// before starts the span of the statement, child of the span of its context
+func (p *otelGormPlugin) before(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		name := operation
+		if db.Statement.Table != "" {
+			name += " " + db.Statement.Table
+		}
+		ctx, span := p.backend.tracer().Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.DBSystemPostgreSQL,
+				semconv.DBOperationName(operation),
+				semconv.DBCollectionName(db.Statement.Table),
+			),
+		)
+		db.Statement.Context = ctx
+		db.InstanceSet(otelSpanKey, span)
+	}
+}
+
+// after ends the span of the statement with its SQL and error
+func (p *otelGormPlugin) after(db *gorm.DB) {
+	v, ok := db.InstanceGet(otelSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := v.(trace.Span)
+	if !ok {
+		return
+	}
+	span.SetAttributes(
+		semconv.DBQueryText(db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+	if db.Error != nil && db.Error != gorm.ErrRecordNotFound {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,198 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// recordSpans makes the global tracer provider record the ended spans
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+// spanAttr returns the value of the attribute key of span
+func spanAttr(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestOTelMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exporter := recordSpans(t)
+	o := &otelBackend{}
+	var fields map[string]string
+	r := gin.New()
+	r.Use(o.Middleware(""))
+	r.GET("/orders/:id", func(c *gin.Context) {
+		fields = map[string]string{}
+		for _, f := range o.LogFields(c.Request.Context()) {
+			fields[f.Key] = f.String
+		}
+		if c.Param("id") == "fail" {
+			c.Error(errors.New("lookup failed"))
+			c.Status(http.StatusInternalServerError)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		status int64
+		code   codes.Code
+		events int
+	}{
+		{name: "ok", path: "/orders/1", status: 200, code: codes.Unset},
+		{name: "server error", path: "/orders/fail", status: 500, code: codes.Error, events: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("recorded %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name != "GET /orders/:id" || span.SpanKind != trace.SpanKindServer {
+				t.Errorf("span %q kind %v, want GET /orders/:id server", span.Name, span.SpanKind)
+			}
+			if got := spanAttr(span, "http.response.status_code").AsInt64(); got != tt.status {
+				t.Errorf("status attribute = %d, want %d", got, tt.status)
+			}
+			if span.Status.Code != tt.code || len(span.Events) != tt.events {
+				t.Errorf("status %v with %d events, want %v with %d", span.Status.Code, len(span.Events), tt.code, tt.events)
+			}
+			if fields["trace_id"] != span.SpanContext.TraceID().String() || fields["span_id"] != span.SpanContext.SpanID().String() {
+				t.Errorf("log fields = %v, want the IDs of the request span", fields)
+			}
+		})
+	}
+}
+
+func TestOTelMiddlewareContinuesTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exporter := recordSpans(t)
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	r := gin.New()
+	r.Use((&otelBackend{}).Middleware(""))
+	r.GET("/", func(c *gin.Context) {})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	if got := spans[0].SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %s, want the incoming one", got)
+	}
+	if got := spans[0].Parent.SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span ID = %s, want the incoming one", got)
+	}
+}
+
+func TestOTelLogFieldsWithoutSpan(t *testing.T) {
+	if fields := (&otelBackend{}).LogFields(context.Background()); fields != nil {
+		t.Errorf("LogFields = %v, want none", fields)
+	}
+}
+
+func TestOTelStartSpan(t *testing.T) {
+	exporter := recordSpans(t)
+	o := &otelBackend{}
+	tests := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "success", code: codes.Unset},
+		{name: "failure", err: errors.New("publish failed"), code: codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+			ctx, finish := o.StartSpan(context.Background(), "publish")
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				t.Error("context carries no span")
+			}
+			finish(tt.err)
+
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("recorded %d spans, want 1", len(spans))
+			}
+			if spans[0].Name != "publish" || spans[0].Status.Code != tt.code {
+				t.Errorf("span %q status %v, want publish %v", spans[0].Name, spans[0].Status.Code, tt.code)
+			}
+		})
+	}
+}
+
+type otelTestItem struct {
+	ID   uint
+	Name string
+}
+
+func TestOTelGormPlugin(t *testing.T) {
+	exporter := recordSpans(t)
+	// statements are only built, nothing connects
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1"}), &gorm.Config{
+		Logger:                 gormlogger.Discard,
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &otelBackend{}
+	if err := db.Use(o.GormPlugin()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, finish := o.StartSpan(context.Background(), "request")
+	db.WithContext(ctx).Where("name = ?", "a").Find(&[]otelTestItem{})
+	finish(nil)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	query, parent := spans[0], spans[1]
+	if query.Name != "SELECT otel_test_items" || query.SpanKind != trace.SpanKindClient {
+		t.Errorf("span %q kind %v, want SELECT otel_test_items client", query.Name, query.SpanKind)
+	}
+	if query.Parent.SpanID() != parent.SpanContext.SpanID() {
+		t.Error("query span is not a child of the span of its context")
+	}
+	if got := spanAttr(query, "db.query.text").AsString(); got != `SELECT * FROM "otel_test_items" WHERE name = $1` {
+		t.Errorf("query text = %q", got)
+	}
+}
@@ -0,0 +1,217 @@
+// Package telemetry traces gin requests, GORM and pgx queries and outgoing
+// HTTP calls, and adds the IDs of the active span to the context logger,
+// through the backend selected by tracing.backend:
+//
+//   - datadog, the Datadog tracer
+//   - otel, an OpenTelemetry tracer provider exporting spans over OTLP/HTTP
+//     to a collector, or to stdout with tracing.otlp.exporter set to stdout
+//   - none, which traces nothing
+//
+// Start, or Hook as soon as it is built, chooses the backend. Databases
+// opened and middleware built before are not traced.
+package telemetry
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robertantonyjaikumar/hangover-common/config"
+	"github.com/robertantonyjaikumar/hangover-common/lifecycle"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	Datadog = "datadog"
+	OTel    = "otel"
+	None    = "none"
+)
+
+// Backend instruments the service for one tracing system
+type Backend interface {
+	Name() string
+	// Start starts exporting spans when cfg enables it
+	Start(cfg config.TracingConfig) error
+	// Flush exports the finished spans
+	Flush(ctx context.Context) error
+	// Shutdown flushes and stops the exporter
+	Shutdown(ctx context.Context) error
+	// Middleware traces every request as a span of service
+	Middleware(service string) gin.HandlerFunc
+	// Transport traces the requests sent through base
+	Transport(base http.RoundTripper) http.RoundTripper
+	// OpenDB opens a pgx pool whose queries are traced
+	OpenDB(dsn string) (*sql.DB, error)
+	// GormPlugin traces the statements run by gorm
+	GormPlugin() gorm.Plugin
+	// StartSpan starts a span child of the span of ctx, finished with the
+	// error of the operation
+	StartSpan(ctx context.Context, operation string) (context.Context, func(err error))
+	// LogFields returns the IDs of the span active in ctx
+	LogFields(ctx context.Context) []zap.Field
+}
+
+var (
+	mu      sync.Mutex
+	current Backend
+	// usedEarly is set when the backend was asked for before one was chosen
+	usedEarly bool
+)
+
+// New returns the backend called name, or the none backend for an unknown name
+func New(name string) Backend {
+	switch name {
+	case Datadog:
+		return &datadogBackend{}
+	case OTel:
+		return &otelBackend{}
+	default:
+		return noneBackend{}
+	}
+}
+
+// Current returns the backend chosen by Start, Hook or SetBackend, the none
+// backend until then
+func Current() Backend {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil {
+		usedEarly = true
+		return noneBackend{}
+	}
+	return current
+}
+
+// SetBackend replaces the backend in use, for tests. Call it before the
+// database is opened and Middleware is registered.
+func SetBackend(b Backend) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = b
+}
+
+// choose makes the backend of cfg.Backend, datadog when empty, the one in
+// use unless one is already chosen, and returns the backend in use
+func choose(cfg config.TracingConfig) Backend {
+	name := cfg.Backend
+	if name == "" {
+		name = Datadog
+	}
+	mu.Lock()
+	b, early, chosen := current, usedEarly, current == nil
+	if chosen {
+		b = New(name)
+		current = b
+	}
+	mu.Unlock()
+
+	switch {
+	case chosen && early:
+		logger.Error("telemetry used before its backend was chosen, what was instrumented then is not traced", zap.String("backend", name))
+	case !chosen && name != b.Name():
+		logger.Error("tracing backend differs from the one in use", zap.String("backend", name), zap.String("in_use", b.Name()))
+	}
+	return b
+}
+
+// Start chooses the backend of cfg, unless Hook or SetBackend did, and starts
+// it. Call it before opening databases and building Middleware.
+func Start(cfg config.TracingConfig) error {
+	return choose(cfg).Start(cfg)
+}
+
+// Flush exports the finished spans of the backend in use
+func Flush(ctx context.Context) error {
+	return started().Flush(ctx)
+}
+
+// Shutdown flushes and stops the backend in use
+func Shutdown(ctx context.Context) error {
+	return started().Shutdown(ctx)
+}
+
+// started returns the backend in use, or the none backend, without counting
+// as a use before the choice
+func started() Backend {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil {
+		return noneBackend{}
+	}
+	return current
+}
+
+// Hook chooses the backend of cfg right away, so middleware built before the
+// hooks run is traced, starts it with the other components and stops it last
+// when appended first
+func Hook(cfg config.TracingConfig) lifecycle.Hook {
+	choose(cfg)
+	return lifecycle.Hook{
+		Name: "telemetry",
+		OnStart: func(context.Context) error {
+			return Start(cfg)
+		},
+		OnStop: Shutdown,
+	}
+}
+
+// Middleware traces every request as a span of service, service.name when
+// empty. Register it before ContextLoggerMiddleware and the body logger.
+func Middleware(service string) gin.HandlerFunc {
+	if service == "" {
+		service = config.Default().GetServiceName()
+	}
+	return Current().Middleware(service)
+}
+
+// Transport traces the requests sent through base, http.DefaultTransport
+// when nil
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return Current().Transport(base)
+}
+
+// NewClient returns a copy of client, http.DefaultClient when nil, tracing
+// its requests
+func NewClient(client *http.Client) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	traced := *client
+	traced.Transport = Transport(client.Transport)
+	return &traced
+}
+
+// OpenDB opens a pgx pool traced by the backend in use
+func OpenDB(dsn string) (*sql.DB, error) {
+	return Current().OpenDB(dsn)
+}
+
+// GormPlugin returns the gorm plugin of the backend in use
+func GormPlugin() gorm.Plugin {
+	return Current().GormPlugin()
+}
+
+// StartSpan starts a span for operation, call finish with its error
+//
+//	ctx, finish := telemetry.StartSpan(ctx, "import.rows")
+//	defer func() { finish(err) }()
+func StartSpan(ctx context.Context, operation string) (context.Context, func(err error)) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return Current().StartSpan(ctx, operation)
+}
+
+// Fields returns the span IDs of ctx in the format of the backend in use.
+// Backends add them to the context loggers when started or registered as
+// middleware.
+func Fields(ctx context.Context) []zap.Field {
+	return Current().LogFields(ctx)
+}
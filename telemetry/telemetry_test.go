@@ -0,0 +1,86 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/robertantonyjaikumar/hangover-common/config"
+)
+
+// resetBackend clears the backend choice for the test
+func resetBackend(t *testing.T) {
+	mu.Lock()
+	previous, early := current, usedEarly
+	current, usedEarly = nil, false
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		current, usedEarly = previous, early
+		mu.Unlock()
+	})
+}
+
+func TestChooseBackend(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func()
+		chosen bool
+		want   string
+	}{
+		{name: "nothing chosen", setup: func() {}, want: None},
+		{name: "default", setup: func() { Start(config.TracingConfig{}) }, chosen: true, want: Datadog},
+		{name: "start", setup: func() { Start(config.TracingConfig{Backend: OTel}) }, chosen: true, want: OTel},
+		{name: "unknown", setup: func() { Start(config.TracingConfig{Backend: "zipkin"}) }, chosen: true, want: None},
+		{name: "hook chooses when built", setup: func() { Hook(config.TracingConfig{Backend: OTel}) }, chosen: true, want: OTel},
+		{name: "shutdown does not choose", setup: func() { Shutdown(context.Background()) }, want: None},
+		{
+			name: "first choice kept",
+			setup: func() {
+				Hook(config.TracingConfig{Backend: None})
+				Start(config.TracingConfig{Backend: OTel})
+			},
+			chosen: true,
+			want:   None,
+		},
+		{
+			name: "set backend",
+			setup: func() {
+				SetBackend(New(OTel))
+				Start(config.TracingConfig{Backend: Datadog})
+			},
+			chosen: true,
+			want:   OTel,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetBackend(t)
+			tt.setup()
+			mu.Lock()
+			chosen, early := current != nil, usedEarly
+			mu.Unlock()
+			if chosen != tt.chosen || early {
+				t.Errorf("chosen %v, used early %v, want chosen %v", chosen, early, tt.chosen)
+			}
+			if got := Current().Name(); got != tt.want {
+				t.Errorf("backend = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrentBeforeChoice(t *testing.T) {
+	resetBackend(t)
+	if got := Current().Name(); got != None {
+		t.Errorf("backend = %q, want %q", got, None)
+	}
+	mu.Lock()
+	early := usedEarly
+	mu.Unlock()
+	if !early {
+		t.Error("use before the choice not recorded")
+	}
+	if got := choose(config.TracingConfig{Backend: OTel}).Name(); got != OTel {
+		t.Errorf("chose %q, want %q", got, OTel)
+	}
+}
@@ -0,0 +1,76 @@
+// Package tracing starts the Datadog tracer from config, traces gin requests
+// and adds the IDs of the active span to the context logger.
+//
+// Deprecated: use the telemetry package, whose datadog backend this package
+// now delegates to. It also selects the backend from tracing.backend and
+// traces queries and outgoing calls.
+package tracing
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robertantonyjaikumar/hangover-common/config"
+	"github.com/robertantonyjaikumar/hangover-common/lifecycle"
+	"github.com/robertantonyjaikumar/hangover-common/telemetry"
+	"go.uber.org/zap"
+	gintrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/gin-gonic/gin"
+)
+
+// datadog is the backend the package level functions delegate to
+var datadog = telemetry.New(telemetry.Datadog)
+
+// Start starts the tracer when cfg enables it
+//
+// Deprecated: use telemetry.Start
+func Start(cfg config.TracingConfig) {
+	datadog.Start(cfg)
+}
+
+// Stop flushes and stops the tracer
+//
+// Deprecated: use telemetry.Shutdown
+func Stop() {
+	datadog.Shutdown(context.Background())
+}
+
+// Hook starts the tracer of cfg with the other components and stops it last
+// when appended first
+//
+// Deprecated: use telemetry.Hook
+func Hook(cfg config.TracingConfig) lifecycle.Hook {
+	return lifecycle.Hook{
+		Name: "tracing",
+		OnStart: func(context.Context) error {
+			Start(cfg)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			Stop()
+			return nil
+		},
+	}
+}
+
+// Middleware traces every request as a span of service, service.name when
+// empty. Register it before ContextLoggerMiddleware and the body logger.
+//
+// Deprecated: use telemetry.Middleware
+func Middleware(service string, opts ...gintrace.Option) gin.HandlerFunc {
+	if service == "" {
+		service = config.Default().GetServiceName()
+	}
+	// also adds the span IDs to the context loggers
+	handler := datadog.Middleware(service)
+	if len(opts) == 0 {
+		return handler
+	}
+	return gintrace.Middleware(service, opts...)
+}
+
+// Fields returns the dd.trace_id and dd.span_id of the span active in ctx
+//
+// Deprecated: use telemetry.Fields
+func Fields(ctx context.Context) []zap.Field {
+	return datadog.LogFields(ctx)
+}
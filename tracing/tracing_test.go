@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robertantonyjaikumar/hangover-common/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+func TestMiddleware(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	core, logs := observer.New(zap.InfoLevel)
+	logger.SetDefault(zap.New(core))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware("orders"))
+	r.GET("/orders/:id", func(c *gin.Context) {
+		logger.FromContext(c.Request.Context()).Info("handled")
+		c.Status(http.StatusNoContent)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders/42", nil))
+
+	spans := mt.FinishedSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if got := span.Tag(ext.ServiceName); got != "orders" {
+		t.Errorf("service = %v, want orders", got)
+	}
+	if got := span.Tag(ext.ResourceName); got != "GET /orders/:id" {
+		t.Errorf("resource = %v, want GET /orders/:id", got)
+	}
+	if got := span.Tag(ext.HTTPCode); got != "204" {
+		t.Errorf("status = %v, want 204", got)
+	}
+
+	entries := logs.FilterMessage("handled").All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d log entries, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if got, want := fields["dd.trace_id"], strconv.FormatUint(span.TraceID(), 10); got != want {
+		t.Errorf("dd.trace_id = %v, want %v", got, want)
+	}
+	if got, want := fields["dd.span_id"], strconv.FormatUint(span.SpanID(), 10); got != want {
+		t.Errorf("dd.span_id = %v, want %v", got, want)
+	}
+}
+
+func TestFieldsWithoutSpan(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if fields := Fields(req.Context()); fields != nil {
+		t.Errorf("Fields = %v, want none", fields)
+	}
+}